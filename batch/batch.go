@@ -0,0 +1,115 @@
+// Package batch reads the list of videos to download in a single run and reports what became of
+// each one
+package batch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"video-downloader/downloader"
+
+	"github.com/pkg/errors"
+)
+
+// Stdin is the path reading the entries from the standard input
+const Stdin = "-"
+
+// detectOrigin is the origin of an entry which lets the site be detected from its URL
+const detectOrigin = "-"
+
+// Entry is a video to download, read from a line `url [origin [output]]` of a batch file
+type Entry struct {
+	URL string
+	// Origin is the site extractor to use, empty to detect it from the URL
+	Origin string
+	// Output names the video, it's an output template such as `{site}/{id}.{ext}` or a plain
+	// name the extension is appended to. Empty keeps the configured naming
+	Output string
+	// Line is the line of the entry in its file, 0 when it does not come from one
+	Line int
+}
+
+// OutputTemplate - Returns the output template naming the video, empty when the entry keeps the
+// configured one
+func (e *Entry) OutputTemplate() string {
+	if "" == e.Output || strings.Contains(e.Output, "{ext}") {
+		return e.Output
+	}
+	return e.Output + ".{ext}"
+}
+
+// Outcome is what became of an entry
+type Outcome struct {
+	Entry  Entry
+	Result *downloader.Result
+	Err    error
+}
+
+// ReadFile - Read the entries of the batch file at path, the standard input when path is `-`
+func ReadFile(path string) ([]Entry, error) {
+	if Stdin == path {
+		entries, err := Parse(os.Stdin)
+		return entries, errors.Wrap(err, "Error reading entries from standard input")
+	}
+	file, err := os.Open(path)
+	if nil != err {
+		return nil, errors.Wrapf(err, "Error opening batch file [%s]", path)
+	}
+	defer file.Close()
+	entries, err := Parse(file)
+	return entries, errors.Wrapf(err, "Error reading batch file [%s]", path)
+}
+
+// Parse - Read one entry per line of r: the URL, optionally followed by the origin and the output
+// name, separated by spaces or tabs. The origin `-` detects the site from the URL and the output
+// name extends to the end of the line. Blank lines and lines starting with `#` are ignored
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := Entry{Line: lineNumber}
+		fields := strings.Fields(line)
+		entry.URL = fields[0]
+		if len(fields) > 1 && detectOrigin != fields[1] {
+			entry.Origin = fields[1]
+		}
+		if len(fields) > 2 {
+			// The output name may hold spaces, keep it whole
+			rest := strings.TrimSpace(line[len(fields[0]):])
+			entry.Output = strings.TrimSpace(rest[len(fields[1]):])
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// WriteSummary - Write to w a line per outcome then the counts of downloaded, skipped and failed
+// videos. Returns the number of failures
+func WriteSummary(w io.Writer, outcomes []Outcome) int {
+	var downloaded, skipped, failed int
+	for _, outcome := range outcomes {
+		switch {
+		case nil != outcome.Err:
+			failed++
+			fmt.Fprintf(w, "FAILED      %s: %v\n", outcome.Entry.URL, outcome.Err)
+		case outcome.Result.Skipped:
+			skipped++
+			fmt.Fprintf(w, "SKIPPED     %s -> %s\n", outcome.Entry.URL, outcome.Result.Path)
+		default:
+			downloaded++
+			fmt.Fprintf(w, "DOWNLOADED  %s -> %s\n", outcome.Entry.URL, outcome.Result.Path)
+		}
+	}
+	fmt.Fprintf(w, "%d video(s): %d downloaded, %d skipped, %d failed\n", len(outcomes), downloaded, skipped, failed)
+	return failed
+}
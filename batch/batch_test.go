@@ -0,0 +1,72 @@
+package batch_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"video-downloader/batch"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	content := `# Videos of the week
+http://u.test/watch?v=abc
+
+http://u.test/watch?v=def	u
+  http://site.test/page - holiday at the sea  
+http://site.test/clip generic clips/{id}.{ext}
+`
+	entries, err := batch.Parse(strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, []batch.Entry{
+		{URL: "http://u.test/watch?v=abc", Line: 2},
+		{URL: "http://u.test/watch?v=def", Origin: "u", Line: 4},
+		{URL: "http://site.test/page", Output: "holiday at the sea", Line: 5},
+		{URL: "http://site.test/clip", Origin: "generic", Output: "clips/{id}.{ext}", Line: 6},
+	}, entries)
+
+	assert.Equal(t, "", entries[0].OutputTemplate())
+	assert.Equal(t, "holiday at the sea.{ext}", entries[2].OutputTemplate())
+	assert.Equal(t, "clips/{id}.{ext}", entries[3].OutputTemplate())
+}
+
+func TestReadFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "batch")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "urls.txt")
+	ioutil.WriteFile(path, []byte("http://u.test/watch?v=abc\n"), 0644)
+	entries, err := batch.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []batch.Entry{{URL: "http://u.test/watch?v=abc", Line: 1}}, entries)
+
+	missing := filepath.Join(directory, "missing.txt")
+	entries, err = batch.ReadFile(missing)
+	assert.Nil(t, entries)
+	assert.Contains(t, err.Error(), "Error opening batch file ["+missing+"]")
+}
+
+func TestWriteSummary(t *testing.T) {
+	outcomes := []batch.Outcome{
+		{Entry: batch.Entry{URL: "http://u.test/1"}, Result: &downloader.Result{Path: "/videos/1.mp4"}},
+		{Entry: batch.Entry{URL: "http://u.test/2"}, Err: errors.New("Server answered [404 Not Found]")},
+		{Entry: batch.Entry{URL: "http://u.test/3"}, Result: &downloader.Result{Path: "/videos/3.mp4", Skipped: true}},
+	}
+	var output bytes.Buffer
+	failed := batch.WriteSummary(&output, outcomes)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, `DOWNLOADED  http://u.test/1 -> /videos/1.mp4
+FAILED      http://u.test/2: Server answered [404 Not Found]
+SKIPPED     http://u.test/3 -> /videos/3.mp4
+3 video(s): 1 downloaded, 1 skipped, 1 failed
+`, output.String())
+}
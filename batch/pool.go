@@ -0,0 +1,136 @@
+package batch
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"video-downloader/downloader"
+
+	"github.com/pkg/errors"
+)
+
+// ProcessFunc handles a single entry, it must stop early once ctx is done
+type ProcessFunc func(ctx context.Context, entry Entry) (*downloader.Result, error)
+
+// Pool contains the settings used to handle many entries at the same time. The zero value handles
+// them one after the other
+type Pool struct {
+	// Concurrency is the number of entries handled at the same time, 1 by default
+	Concurrency int `mapstructure:"concurrency"`
+	// PerHost bounds the entries of a same host handled at the same time, 0 does not bound them
+	PerHost int `mapstructure:"per_host"`
+}
+
+// scheduler hands the entries to the workers, in order, skipping the ones whose host is busy
+type scheduler struct {
+	ctx     context.Context
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	pending []int
+	hosts   []string
+	active  map[string]int
+	perHost int
+	stopped bool
+}
+
+// Run - Call process for every entry with Concurrency goroutines, returns an outcome per entry in
+// the order of entries. Entries are started in order, except when their host already has PerHost
+// running ones. Once ctx is done no entry is started anymore, those left are reported as canceled
+func (p *Pool) Run(ctx context.Context, entries []Entry, process ProcessFunc) []Outcome {
+	outcomes := make([]Outcome, len(entries))
+	s := &scheduler{ctx: ctx, active: map[string]int{}, perHost: p.PerHost}
+	s.cond = sync.NewCond(&s.mutex)
+	for i, entry := range entries {
+		outcomes[i].Entry = entry
+		s.pending = append(s.pending, i)
+		s.hosts = append(s.hosts, entryHost(entry))
+	}
+
+	// Wake up the workers waiting for a host once canceled, the others check ctx themselves
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stop()
+		case <-stopWatching:
+		}
+	}()
+
+	concurrency := p.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(entries) {
+		concurrency = len(entries)
+	}
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := s.next()
+				if !ok {
+					return
+				}
+				outcomes[i].Result, outcomes[i].Err = process(ctx, entries[i])
+				s.release(s.hosts[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, i := range s.pending {
+		outcomes[i].Err = errors.Wrap(ctx.Err(), "Canceled before being started")
+	}
+	return outcomes
+}
+
+// entryHost - Returns the lowercased host of the entry URL, empty when it can't be parsed
+func entryHost(entry Entry) string {
+	parsed, err := url.Parse(entry.URL)
+	if nil != err {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// next - Returns the index of the next entry to handle, false once there is none or the run stopped
+func (s *scheduler) next() (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for {
+		if s.stopped || nil != s.ctx.Err() || 0 == len(s.pending) {
+			return 0, false
+		}
+		for position, i := range s.pending {
+			host := s.hosts[i]
+			if s.perHost > 0 && s.active[host] >= s.perHost {
+				continue
+			}
+			s.active[host]++
+			s.pending = append(s.pending[:position], s.pending[position+1:]...)
+			return i, true
+		}
+		// Every pending entry waits for its host
+		s.cond.Wait()
+	}
+}
+
+// release - Tell an entry of host is finished
+func (s *scheduler) release(host string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.active[host]--
+	s.cond.Broadcast()
+}
+
+// stop - Don't start any entry anymore
+func (s *scheduler) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopped = true
+	s.cond.Broadcast()
+}
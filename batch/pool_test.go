@@ -0,0 +1,84 @@
+package batch_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"video-downloader/batch"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolRun(t *testing.T) {
+	var entries []batch.Entry
+	for i := 0; i < 12; i++ {
+		entries = append(entries, batch.Entry{URL: fmt.Sprintf("http://host%d.test/%d", i%3, i)})
+	}
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	runningPerHost, maxPerHost := map[string]int{}, 0
+	pool := &batch.Pool{Concurrency: 5, PerHost: 1}
+	outcomes := pool.Run(context.Background(), entries, func(ctx context.Context, entry batch.Entry) (*downloader.Result, error) {
+		host := entry.URL[:len("http://host0.test")]
+		mutex.Lock()
+		running++
+		runningPerHost[host]++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if runningPerHost[host] > maxPerHost {
+			maxPerHost = runningPerHost[host]
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		runningPerHost[host]--
+		mutex.Unlock()
+		if "http://host1.test/4" == entry.URL {
+			return nil, fmt.Errorf("Failure of [%s]", entry.URL)
+		}
+		return &downloader.Result{Path: entry.URL}, nil
+	})
+
+	// 3 hosts of a single running entry each
+	assert.Equal(t, 3, maxRunning)
+	assert.Equal(t, 1, maxPerHost)
+	if assert.Len(t, outcomes, len(entries)) {
+		for i, outcome := range outcomes {
+			assert.Equal(t, entries[i], outcome.Entry)
+			if 4 == i {
+				assert.EqualError(t, outcome.Err, "Failure of [http://host1.test/4]")
+				continue
+			}
+			assert.Nil(t, outcome.Err)
+			assert.Equal(t, entries[i].URL, outcome.Result.Path)
+		}
+	}
+}
+
+func TestPoolRunCanceled(t *testing.T) {
+	entries := []batch.Entry{{URL: "http://u.test/1"}, {URL: "http://u.test/2"}, {URL: "http://u.test/3"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The zero value handles entries one after the other, the first one cancels the run
+	outcomes := (&batch.Pool{}).Run(ctx, entries, func(ctx context.Context, entry batch.Entry) (*downloader.Result, error) {
+		cancel()
+		return &downloader.Result{Path: entry.URL}, nil
+	})
+	assert.Len(t, outcomes, 3)
+	assert.Nil(t, outcomes[0].Err)
+	for _, outcome := range outcomes[1:] {
+		assert.Nil(t, outcome.Result)
+		assert.EqualError(t, outcome.Err, "Canceled before being started: context canceled")
+	}
+
+	assert.Empty(t, (&batch.Pool{Concurrency: 4}).Run(context.Background(), nil, nil))
+}
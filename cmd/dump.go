@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"video-downloader/downloader"
+)
+
+// videoDump is the document printed by `--dump-json`
+type videoDump struct {
+	*downloader.VideoInfos
+	// WebpageURL is the URL given to the extractor
+	WebpageURL string `json:"webpage_url"`
+	// SelectedFormat is the format a download would take, absent when the site offers a single one
+	SelectedFormat *downloader.Format `json:"selected_format,omitempty"`
+	// SelectionError tells why no format was selected, the rest of the document is still valid
+	SelectionError string `json:"selection_error,omitempty"`
+}
+
+// dumpJSON - Write to out everything the extractor resolved for pageURL as a single JSON document.
+// A selector matching no format doesn't prevent the document from being written
+func dumpJSON(out io.Writer, vi *downloader.VideoInfos, pageURL string, selector string) error {
+	dump := videoDump{VideoInfos: vi, WebpageURL: pageURL}
+	if len(vi.Formats) > 0 {
+		selected, err := downloader.SelectFormat(vi.Formats, selector)
+		if nil != err {
+			dump.SelectionError = err.Error()
+		}
+		dump.SelectedFormat = selected
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	// Titles and selectors are printed as they are, not escaped for HTML
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(dump)
+}
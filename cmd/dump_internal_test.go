@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpJSON(t *testing.T) {
+	vi := &downloader.VideoInfos{
+		URL: "https://cdn.u.test/22.mp4", Extension: ".mp4", Title: "Lesson", ID: "abc", Site: "u", Uploader: "Alice", Date: "20190304", Duration: 60,
+		Formats: []downloader.Format{
+			{ID: "22", URL: "https://cdn.u.test/22.mp4", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.64001F, mp4a.40.2", Width: 1280, Height: 720, Bitrate: 2000000},
+			{ID: "140", URL: "https://cdn.u.test/140.m4a", Extension: ".m4a", MimeType: "audio/mp4", Codecs: "mp4a.40.2", Bitrate: 128000, Size: 960000},
+		},
+	}
+
+	// Right case - the keys the ingestion pipeline reads
+	var out bytes.Buffer
+	assert.Nil(t, dumpJSON(&out, vi, "https://u.test/watch?v=abc", "best"))
+	assert.Equal(t, `{
+  "url": "https://cdn.u.test/22.mp4",
+  "extension": ".mp4",
+  "title": "Lesson",
+  "id": "abc",
+  "site": "u",
+  "uploader": "Alice",
+  "date": "20190304",
+  "duration": 60,
+  "formats": [
+    {
+      "id": "22",
+      "url": "https://cdn.u.test/22.mp4",
+      "extension": ".mp4",
+      "mime_type": "video/mp4",
+      "codecs": "avc1.64001F, mp4a.40.2",
+      "width": 1280,
+      "height": 720,
+      "bitrate": 2000000
+    },
+    {
+      "id": "140",
+      "url": "https://cdn.u.test/140.m4a",
+      "extension": ".m4a",
+      "mime_type": "audio/mp4",
+      "codecs": "mp4a.40.2",
+      "bitrate": 128000,
+      "size": 960000
+    }
+  ],
+  "webpage_url": "https://u.test/watch?v=abc",
+  "selected_format": {
+    "id": "22",
+    "url": "https://cdn.u.test/22.mp4",
+    "extension": ".mp4",
+    "mime_type": "video/mp4",
+    "codecs": "avc1.64001F, mp4a.40.2",
+    "width": 1280,
+    "height": 720,
+    "bitrate": 2000000
+  }
+}
+`, out.String())
+
+	// Right case - no format matches, the document is still written
+	out.Reset()
+	assert.Nil(t, dumpJSON(&out, &downloader.VideoInfos{URL: vi.URL, Extension: ".mp4", Title: "Lesson", Formats: vi.Formats[:1]}, "https://u.test/watch?v=abc", "best[height<=240]"))
+	assert.Equal(t, `{
+  "url": "https://cdn.u.test/22.mp4",
+  "extension": ".mp4",
+  "title": "Lesson",
+  "formats": [
+    {
+      "id": "22",
+      "url": "https://cdn.u.test/22.mp4",
+      "extension": ".mp4",
+      "mime_type": "video/mp4",
+      "codecs": "avc1.64001F, mp4a.40.2",
+      "width": 1280,
+      "height": 720,
+      "bitrate": 2000000
+    }
+  ],
+  "webpage_url": "https://u.test/watch?v=abc",
+  "selection_error": "No format matches [best[height<=240]]"
+}
+`, out.String())
+
+	// Right case - separate tracks, without formats
+	out.Reset()
+	tracks := &downloader.VideoInfos{
+		Title: "Tracks",
+		Video: &downloader.Track{URL: "https://cdn.u.test/v.mp4", Extension: ".mp4", Codecs: "avc1.640028", Bandwidth: 4000000, Width: 1920, Height: 1080},
+		Audio: &downloader.Track{URL: "https://cdn.u.test/a.m4a", Extension: ".m4a"},
+	}
+	assert.Nil(t, dumpJSON(&out, tracks, "https://u.test/watch?v=def", ""))
+	assert.Equal(t, `{
+  "url": "",
+  "extension": "",
+  "title": "Tracks",
+  "video": {
+    "url": "https://cdn.u.test/v.mp4",
+    "extension": ".mp4",
+    "codecs": "avc1.640028",
+    "bandwidth": 4000000,
+    "width": 1920,
+    "height": 1080
+  },
+  "audio": {
+    "url": "https://cdn.u.test/a.m4a",
+    "extension": ".m4a"
+  },
+  "webpage_url": "https://u.test/watch?v=def"
+}
+`, out.String())
+}
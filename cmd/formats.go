@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"video-downloader/downloader"
+)
+
+// printFormats - Write to out a table of every format available for the video. The format the
+// selector would download is flagged
+func printFormats(out io.Writer, vi *downloader.VideoInfos, selector string) error {
+	formats := vi.Formats
+	if 0 == len(formats) {
+		formats = singleFormats(vi)
+	}
+	var selectedID string
+	if selected, err := downloader.SelectFormat(vi.Formats, selector); nil == err {
+		selectedID = selected.ID
+	}
+
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tEXT\tCODECS\tRESOLUTION\tBITRATE\tSIZE\tNOTE")
+	for i := range formats {
+		f := &formats[i]
+		var notes []string
+		if f.AudioOnly() {
+			notes = append(notes, "audio only")
+		} else if f.VideoOnly() {
+			notes = append(notes, "video only")
+		}
+		if "" != selectedID && f.ID == selectedID {
+			notes = append(notes, "selected")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			orUnknown(f.ID), orUnknown(strings.TrimPrefix(f.Extension, ".")), orUnknown(f.Codecs),
+			formatResolution(f), formatBitrate(f.Bitrate), formatApproximateSize(f, vi.Duration), strings.Join(notes, ", "))
+	}
+	return table.Flush()
+}
+
+// singleFormats - Returns the formats of a video offered as a single file or as separate tracks
+func singleFormats(vi *downloader.VideoInfos) []downloader.Format {
+	if nil == vi.Video && nil == vi.Audio {
+		return []downloader.Format{{ID: "default", URL: vi.URL, Extension: vi.Extension}}
+	}
+	var formats []downloader.Format
+	if nil != vi.Video {
+		formats = append(formats, downloader.Format{ID: "video", URL: vi.Video.URL, Extension: vi.Video.Extension,
+			MimeType: "video/" + strings.TrimPrefix(vi.Video.Extension, "."), Codecs: vi.Video.Codecs,
+			Width: vi.Video.Width, Height: vi.Video.Height, Bitrate: vi.Video.Bandwidth})
+	}
+	if nil != vi.Audio {
+		formats = append(formats, downloader.Format{ID: "audio", URL: vi.Audio.URL, Extension: vi.Audio.Extension,
+			MimeType: "audio/" + strings.TrimPrefix(vi.Audio.Extension, "."), Codecs: vi.Audio.Codecs, Bitrate: vi.Audio.Bandwidth})
+	}
+	return formats
+}
+
+func orUnknown(value string) string {
+	if "" == value {
+		return "-"
+	}
+	return value
+}
+
+func formatResolution(f *downloader.Format) string {
+	switch {
+	case f.AudioOnly():
+		return "audio"
+	case f.Width > 0 && f.Height > 0:
+		return fmt.Sprintf("%dx%d", f.Width, f.Height)
+	case f.Height > 0:
+		return fmt.Sprintf("%dp", f.Height)
+	}
+	return "-"
+}
+
+func formatBitrate(bitrate int64) string {
+	if bitrate <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dk", bitrate/1000)
+}
+
+// formatApproximateSize - The size the site tells, else the one estimated from the bitrate and duration
+func formatApproximateSize(f *downloader.Format, duration float64) string {
+	if f.Size > 0 {
+		return formatBytes(f.Size)
+	}
+	if f.Bitrate > 0 && duration > 0 {
+		return "~" + formatBytes(int64(float64(f.Bitrate)*duration/8))
+	}
+	return "-"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintFormats(t *testing.T) {
+	vi := &downloader.VideoInfos{
+		Duration: 100,
+		Formats: []downloader.Format{
+			{ID: "18", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.42001E, mp4a.40.2", Width: 640, Height: 360, Bitrate: 500000},
+			{ID: "22", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.64001F, mp4a.40.2", Width: 1280, Height: 720, Bitrate: 2000000},
+			{ID: "137", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.640028", Height: 1080, Size: 52428800},
+			{ID: "140", Extension: ".m4a", MimeType: "audio/mp4", Codecs: "mp4a.40.2", Bitrate: 128000},
+			{ID: "x"},
+		},
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, printFormats(&out, vi, "best"))
+	assert.Equal(t, ""+
+		"ID   EXT  CODECS                  RESOLUTION  BITRATE  SIZE      NOTE\n"+
+		"18   mp4  avc1.42001E, mp4a.40.2  640x360     500k     ~6.0MiB   \n"+
+		"22   mp4  avc1.64001F, mp4a.40.2  1280x720    2000k    ~23.8MiB  selected\n"+
+		"137  mp4  avc1.640028             1080p       -        50.0MiB   video only\n"+
+		"140  m4a  mp4a.40.2               audio       128k     ~1.5MiB   audio only\n"+
+		"x    -    -                       -           -        -         \n", out.String())
+
+	// Right case - the selector matching nothing flags no format
+	out.Reset()
+	assert.Nil(t, printFormats(&out, vi, "best[height<=240]"))
+	assert.NotContains(t, out.String(), "selected")
+
+	// Right case - a single file
+	out.Reset()
+	assert.Nil(t, printFormats(&out, &downloader.VideoInfos{URL: "https://cdn.test/v.webm", Extension: ".webm"}, ""))
+	assert.Equal(t, ""+
+		"ID       EXT   CODECS  RESOLUTION  BITRATE  SIZE  NOTE\n"+
+		"default  webm  -       -           -        -     \n", out.String())
+
+	// Right case - separate tracks
+	out.Reset()
+	assert.Nil(t, printFormats(&out, &downloader.VideoInfos{
+		Duration: 10,
+		Video:    &downloader.Track{URL: "https://cdn.test/v.mp4", Extension: ".mp4", Codecs: "avc1.640028", Bandwidth: 4000000, Width: 1920, Height: 1080},
+		Audio:    &downloader.Track{URL: "https://cdn.test/a.m4a", Extension: ".m4a", Codecs: "mp4a.40.2", Bandwidth: 128000},
+	}, ""))
+	assert.Equal(t, ""+
+		"ID     EXT  CODECS       RESOLUTION  BITRATE  SIZE       NOTE\n"+
+		"video  mp4  avc1.640028  1920x1080   4000k    ~4.8MiB    video only\n"+
+		"audio  m4a  mp4a.40.2    audio       128k     ~156.2KiB  audio only\n", out.String())
+}
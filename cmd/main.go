@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	"video-downloader/batch"
 	"video-downloader/configloader"
 	"video-downloader/downloader"
-	"video-downloader/parsingelement"
+	_ "video-downloader/parsingelement/direct"
+	_ "video-downloader/parsingelement/generic"
+	_ "video-downloader/parsingelement/u"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 )
 
 // Instanciate logrus, parse the program flags and load Configuration
-func setUp() (*parsingelement.ParsingInformations, time.Time) {
+func setUp() (*configloader.Configuration, time.Time) {
 	startTime := time.Now()
 	pflag.Parse()
 
@@ -34,43 +41,193 @@ func setUp() (*parsingelement.ParsingInformations, time.Time) {
 		logrus.Fatalf("Logrus logger level doesn't exist")
 	}
 
-	parsingInformations, err := configloader.ReadConfig(*configurationPath)
+	configuration, err := configloader.ReadConfig(*configurationPath)
 	if nil != err {
 		logrus.Fatalf("Error loading configuration [%s], reason: %v", *configurationPath, err)
 	}
-	logrus.Debugf("Loaded configuration: %v", parsingInformations)
+	if "" != *outputTemplate {
+		configuration.Downloader.OutputTemplate = *outputTemplate
+	}
+	if "" != *formatSelector {
+		configuration.Downloader.Format = *formatSelector
+	}
+	if err = downloader.ValidateFormat(configuration.Downloader.Format); nil != err {
+		logrus.Fatalf("Invalid format [%s], reason: %v", configuration.Downloader.Format, err)
+	}
+	if *concurrency > 0 {
+		configuration.Batch.Concurrency = *concurrency
+	}
+	if *perHost > 0 {
+		configuration.Batch.PerHost = *perHost
+	}
+	if "" != *cookiesPath {
+		configuration.Cookies = *cookiesPath
+	}
+	if *saveCookies {
+		configuration.SaveCookies = true
+	}
+	if err = configuration.LoadCookies(); nil != err {
+		logrus.Fatalf("Could not load cookies, reason: %v", err)
+	}
+	configuration.Downloader.Progress = newProgressReporter(os.Stdout, configuration.Batch.Concurrency > 1)
+	logrus.Debugf("Loaded configuration: %v", configuration)
 
-	if err = os.MkdirAll(*destinationPath, 0777); nil != err {
-		logrus.Fatalf("Could not create temporary path for Downloaded video, reason %v", err)
+	// Listing formats or dumping informations downloads nothing
+	if !*listFormats && !*dumpJSONInfos {
+		if err = os.MkdirAll(*destinationPath, 0777); nil != err {
+			logrus.Fatalf("Could not create temporary path for Downloaded video, reason %v", err)
+		}
 	}
 
-	return parsingInformations, startTime
+	return configuration, startTime
 }
 
 var configurationPath = pflag.StringP("configuration", "c", "", "To run the program needs to get some configuration")
 var loggerLvl = pflag.String("logLvl", "InfoLevel", "The level of log to show [default = InfoLevel]. Available are (PanicLevel, FatalLevel, ErrorLevel, WarnLevel, InfoLevel, DebugLevel). For more information, llo, at Logrus doc 'type level'")
 
-//var fileURLDownload = pflag.StringP("file_infos", "f", "", "The program will try to download all video from this file")
+var fileURLDownload = pflag.StringP("file_infos", "f", "", "The program will try to download all video from this file, `-` reads the standard input. Each line holds an url, optionally followed by its origin (`-` to detect it) and its output name")
 var videoURlDownload = pflag.StringP("url", "u", "", "The program will try to download the video on this url")
-var videoSiteOrigin = pflag.StringP("origin", "o", "", "The program will parse according to the origin web site you gave")
+var videoSiteOrigin = pflag.StringP("origin", "o", "", "The program will parse according to the origin web site you gave, detected from the url when omitted")
 var destinationPath = pflag.StringP("destination", "d", "", "The program will write every final video in this directory")
+var formatSelector = pflag.String("format", "", "The program will download the format picked by this selector when the site offers many, eg `best[height<=720][ext=mp4]` or `worst` [default = best]. Filters apply to (height, width, bitrate, size, id, ext, mime, codecs), alternatives are separated by `/`")
+var listFormats = pflag.Bool("list-formats", false, "The program will print every format available for the video and exit without downloading")
+var dumpJSONInfos = pflag.Bool("dump-json", false, "The program will print everything resolved for the video as a JSON document and exit without downloading")
+var concurrency = pflag.IntP("concurrency", "j", 0, "The program will download this many videos at the same time [default = batch.concurrency of the configuration, else 1]")
+var perHost = pflag.Int("per-host", 0, "The program will download at most this many videos of a same host at the same time [default = batch.per_host of the configuration, else unbounded]")
+var cookiesPath = pflag.String("cookies", "", "The program will send the cookies of this Netscape `cookies.txt` file with every request, eg those of a logged-in session [default = cookies of the configuration]")
+var saveCookies = pflag.Bool("save-cookies", false, "The program will write the updated cookies back to the cookies file once done [default = save_cookies of the configuration]")
+var outputTemplate = pflag.StringP("template", "t", "", "The program will name every video after this template, eg `{site}/{uploader}/{date}-{title}.{ext}`. Available fields are (id, site, uploader, date, title, ext)")
 
-func main() {
-	// Load conf, Load URL site where a video has to be downloaded and init what has to be
-	parsingInformations, startTime := setUp()
+// readEntries - Returns the videos to work on, from the url flag then the batch file
+func readEntries() []batch.Entry {
+	var entries []batch.Entry
+	if "" != *videoURlDownload {
+		entries = append(entries, batch.Entry{URL: *videoURlDownload, Origin: *videoSiteOrigin})
+	}
+	if "" != *fileURLDownload {
+		fileEntries, err := batch.ReadFile(*fileURLDownload)
+		if nil != err {
+			logrus.Fatalf("Error loading videos to download, reason: %v", err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	if 0 == len(entries) {
+		logrus.Fatalf("No video to download, give an url or a file of urls")
+	}
+	return entries
+}
 
-	videoInfos, err := parsingInformations.ParseOn(*videoSiteOrigin, *videoURlDownload)
+// describeEntry - Print the formats or the informations of the entry rather than downloading it
+func describeEntry(ctx context.Context, configuration *configloader.Configuration, entry batch.Entry) error {
+	videoInfos, err := configuration.ParsingInformations.ParseOn(ctx, entry.Origin, entry.URL)
 	if nil != err {
-		logrus.Fatalf("Error working on site [%s]; url [%s], reason: %v", *videoSiteOrigin, *videoSiteOrigin, err)
+		return errors.Wrap(err, "Error extracting video")
+	}
+	if *listFormats {
+		return errors.Wrap(printFormats(os.Stdout, videoInfos, configuration.Downloader.Format), "Error printing formats")
 	}
+	return errors.Wrap(dumpJSON(os.Stdout, videoInfos, entry.URL, configuration.Downloader.Format), "Error dumping informations")
+}
 
-	var fileGenerated string
-	if fileGenerated, err = downloader.GetVideo(videoInfos, *destinationPath); nil != err {
-		logrus.Errorf("Run `getVideo` error on url [%s], reason: %v", *videoSiteOrigin, err)
+// downloadEntry - Extract the video of the entry and download it
+func downloadEntry(ctx context.Context, configuration *configloader.Configuration, entry batch.Entry) (*downloader.Result, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, errors.Wrap(err, "Canceled before being started")
+	}
+	videoInfos, err := configuration.ParsingInformations.ParseOn(ctx, entry.Origin, entry.URL)
+	if nil != err {
+		return nil, errors.Wrap(err, "Error extracting video")
 	}
-	logrus.Infof("Downloaded video [%s] in file [%s]\n", *videoSiteOrigin, fileGenerated)
+
+	d := configuration.Downloader
+	if template := entry.OutputTemplate(); "" != template {
+		d.OutputTemplate = template
+	}
+	result, err := d.GetVideo(ctx, videoInfos, *destinationPath)
+	if nil != err {
+		return nil, errors.Wrap(err, "Run `getVideo` error")
+	}
+	if result.Skipped {
+		logrus.Infof("Skipped video [%s], file [%s] already exists (policy [%s])", entry.URL, result.Path, result.Policy)
+	} else if nil != result.MuxError {
+		logrus.Warnf("Downloaded video [%s] in track files %v, they could not be muxed: %v (policy [%s])", entry.URL, result.Tracks, result.MuxError, result.Policy)
+	} else if len(result.Tracks) > 0 {
+		logrus.Infof("Downloaded video [%s] in track files %v (policy [%s])", entry.URL, result.Tracks, result.Policy)
+	} else {
+		logrus.Infof("Downloaded video [%s] in file [%s] (policy [%s])", entry.URL, result.Path, result.Policy)
+	}
+	return result, nil
+}
+
+func main() {
+	// Load conf, Load URL site where a video has to be downloaded and init what has to be
+	configuration, startTime := setUp()
+	entries := readEntries()
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if *listFormats || *dumpJSONInfos {
+		failed := 0
+		for _, entry := range entries {
+			if err := describeEntry(ctx, configuration, entry); nil != err {
+				logrus.Errorf("Error on url [%s], reason: %v", entry.URL, err)
+				failed++
+			}
+		}
+		storeCookies(configuration)
+		if failed > 0 {
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A failed video does not prevent the next ones from being downloaded
+	outcomes := configuration.Batch.Run(ctx, entries, func(ctx context.Context, entry batch.Entry) (*downloader.Result, error) {
+		result, err := downloadEntry(ctx, configuration, entry)
+		if nil != err {
+			logrus.Errorf("Error on url [%s], reason: %v", entry.URL, err)
+		}
+		return result, err
+	})
+	failed := batch.WriteSummary(os.Stdout, outcomes)
+	storeCookies(configuration)
 
 	finishTime := time.Now()
 	delta := finishTime.Sub(startTime)
 	logrus.Infof("\nDownload accomplished in %v\n", delta)
+	if failed > 0 {
+		stop()
+		os.Exit(1)
+	}
+}
+
+// storeCookies - Save the cookies of the run, a failure does not fail the run
+func storeCookies(configuration *configloader.Configuration) {
+	if err := configuration.StoreCookies(); nil != err {
+		logrus.Errorf("Could not save cookies, reason: %v", err)
+	}
+}
+
+// interruptContext - Returns a context canceled by the first interruption or termination: running
+// downloads stop and remove their partial files, no other one is started. A second one exits at once
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		logrus.Warnf("Interrupted, running downloads are stopped and their partial files removed. Interrupt again to quit at once")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"video-downloader/downloader"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// progressBarWidth is the number of characters of the bar itself
+const progressBarWidth = 30
+
+// progressLogInterval is the delay between two progress log lines when stdout is not a terminal
+const progressLogInterval = 10 * time.Second
+
+// newProgressReporter - Draw a progress bar when out is a terminal, log a line from time to time
+// otherwise so long downloads don't look hung in CI logs. Concurrent downloads are always logged,
+// a single bar can't show them all
+func newProgressReporter(out *os.File, concurrent bool) downloader.ProgressFunc {
+	if !concurrent && terminal.IsTerminal(int(out.Fd())) {
+		return progressBar(out)
+	}
+	return progressLog()
+}
+
+// progressBar - Redraw a single line on out at every report
+func progressBar(out io.Writer) downloader.ProgressFunc {
+	var mutex sync.Mutex
+	return func(p downloader.Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		bar := strings.Repeat(" ", progressBarWidth)
+		percent := "  ?  %"
+		if p.Total > 0 {
+			filled := int(int64(progressBarWidth) * p.Done / p.Total)
+			if filled > progressBarWidth {
+				filled = progressBarWidth
+			}
+			bar = strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+			percent = fmt.Sprintf("%5.1f%%", float64(p.Done)*100/float64(p.Total))
+		}
+		fmt.Fprintf(out, "\r[%s] %s %s %s ETA %s\x1b[K", bar, percent, formatSize(p.Done, p.Total), formatSpeed(p.Speed), formatETA(p.ETA))
+		if p.Finished {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// progressLog - Log the progress of every file at most once per progressLogInterval
+func progressLog() downloader.ProgressFunc {
+	var mutex sync.Mutex
+	lastLogs := map[string]time.Time{}
+	return func(p downloader.Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !p.Finished && time.Since(lastLogs[p.Filename]) < progressLogInterval {
+			return
+		}
+		lastLogs[p.Filename] = time.Now()
+		if p.Finished {
+			delete(lastLogs, p.Filename)
+		}
+		logrus.Infof("Downloading [%s]: %s %s ETA %s", p.Filename, formatSize(p.Done, p.Total), formatSpeed(p.Speed), formatETA(p.ETA))
+	}
+}
+
+// formatBytes - Human readable amount of bytes
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	value := float64(bytes)
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		value /= unit
+		if value < unit {
+			return fmt.Sprintf("%.1f%s", value, suffix)
+		}
+	}
+	return fmt.Sprintf("%.1fTiB", value/unit)
+}
+
+func formatSize(done int64, total int64) string {
+	if total < 0 {
+		return formatBytes(done)
+	}
+	return formatBytes(done) + "/" + formatBytes(total)
+}
+
+func formatSpeed(speed float64) string {
+	return formatBytes(int64(speed)) + "/s"
+}
+
+func formatETA(eta time.Duration) string {
+	if eta < 0 {
+		return "--"
+	}
+	return eta.Truncate(time.Second).String()
+}
@@ -2,15 +2,42 @@ package configloader
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"video-downloader/batch"
+	"video-downloader/downloader"
+	"video-downloader/httpclient"
 	"video-downloader/parsingelement"
+	"video-downloader/retry"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// Configuration gathers everything read from the configuration file
+type Configuration struct {
+	// ParsingInformations holds every registered extractor, each one read from the section named after it
+	ParsingInformations parsingelement.ParsingInformations `mapstructure:"-"`
+	Downloader          downloader.Downloader              `mapstructure:"downloader"`
+	// Batch tells how many videos are downloaded at the same time
+	Batch batch.Pool `mapstructure:"batch"`
+	// Retry is shared by every request sent by extractors and the downloader
+	Retry retry.Policy `mapstructure:"retry"`
+	// Timeouts bound every request, a site overrides them with the `timeouts` key of its section
+	Timeouts httpclient.Timeouts `mapstructure:"timeouts"`
+	// HTTP tells how every request is sent, a site overrides it with the `http` key of its section
+	HTTP httpclient.Options `mapstructure:"http"`
+	// Cookies is the Netscape cookies.txt file whose cookies are sent with every request
+	Cookies string `mapstructure:"cookies"`
+	// SaveCookies writes the cookies back to the Cookies file once the run is over
+	SaveCookies bool `mapstructure:"save_cookies"`
+	// Jar holds the cookies shared by the extractors and the downloader
+	Jar *httpclient.CookieJar `mapstructure:"-"`
+}
+
 // ReadConfig is used to parse the configuration file and returns the error encountered if there is
-func ReadConfig(configPath string) (*parsingelement.ParsingInformations, error) {
+func ReadConfig(configPath string) (*Configuration, error) {
 	var err error
 	if "" == configPath {
 		return nil, errors.New("No configuraiton path provided")
@@ -28,14 +55,77 @@ func ReadConfig(configPath string) (*parsingelement.ParsingInformations, error)
 		return nil, errors.Wrapf(err, "Error reading configuration from file %s", configPath)
 	}
 
-	pi := parsingelement.ParsingInformations{}
-	if err = viper.Unmarshal(&pi); nil != err {
+	// Check viper has read something to populate structure fields
+	if 0 == len(viper.AllKeys()) {
+		return nil, errors.New("Viper hasn't populated struct from configuration file")
+	}
+
+	conf := Configuration{}
+	if err = viper.Unmarshal(&conf); nil != err {
 		return nil, errors.Wrapf(err, "Error Unmarshalling configuration file %s", configPath)
 	}
 
-	// Check viper has populates tructure field
-	if (parsingelement.ParsingInformations{}) == pi {
-		return nil, errors.New("Viper hasn't populated struct from configuration file")
+	conf.Downloader.Retry = &conf.Retry
+	conf.Jar = httpclient.NewCookieJar()
+	conf.HTTP.Jar = conf.Jar
+	if conf.Downloader.Client, err = httpclient.New(conf.HTTP, conf.Timeouts); nil != err {
+		return nil, errors.Wrapf(err, "Invalid [http] section of configuration file %s", configPath)
+	}
+	conf.Downloader.SiteClients = map[string]*http.Client{}
+	for _, name := range parsingelement.Registered() {
+		var extractor parsingelement.Extractor
+		if extractor, err = parsingelement.New(name); nil != err {
+			return nil, err
+		}
+		if err = viper.UnmarshalKey(name, extractor); nil != err {
+			return nil, errors.Wrapf(err, "Error Unmarshalling [%s] section of configuration file %s", name, configPath)
+		}
+		if validator, ok := extractor.(parsingelement.Validator); ok {
+			if err = validator.Validate(); nil != err {
+				return nil, errors.Wrapf(err, "Invalid [%s] section of configuration file %s", name, configPath)
+			}
+		}
+
+		client := conf.Downloader.Client
+		if viper.IsSet(name+".timeouts") || viper.IsSet(name+".http") {
+			var siteTimeouts httpclient.Timeouts
+			if err = viper.UnmarshalKey(name+".timeouts", &siteTimeouts); nil != err {
+				return nil, errors.Wrapf(err, "Error Unmarshalling [%s] timeouts of configuration file %s", name, configPath)
+			}
+			var siteOptions httpclient.Options
+			if err = viper.UnmarshalKey(name+".http", &siteOptions); nil != err {
+				return nil, errors.Wrapf(err, "Error Unmarshalling [%s] http options of configuration file %s", name, configPath)
+			}
+			if client, err = httpclient.New(conf.HTTP.Override(siteOptions), conf.Timeouts.Override(siteTimeouts)); nil != err {
+				return nil, errors.Wrapf(err, "Invalid [%s.http] section of configuration file %s", name, configPath)
+			}
+			conf.Downloader.SiteClients[name] = client
+		}
+		if user, ok := extractor.(parsingelement.DependencyUser); ok {
+			user.UseDependencies(parsingelement.Dependencies{Retry: &conf.Retry, Client: client})
+		}
+		conf.ParsingInformations.Add(extractor)
+	}
+	return &conf, nil
+}
+
+// LoadCookies - Put the cookies of the Cookies file in the jar, if any. When the cookies are saved,
+// a missing file is an empty jar: it is created once the run is over
+func (conf *Configuration) LoadCookies() error {
+	if "" == conf.Cookies {
+		return nil
+	}
+	if _, err := os.Stat(conf.Cookies); conf.SaveCookies && os.IsNotExist(err) {
+		logrus.Infof("Cookies file [%s] does not exist yet, it will be created", conf.Cookies)
+		return nil
+	}
+	return conf.Jar.Load(conf.Cookies)
+}
+
+// StoreCookies - Write the cookies of the jar back to the Cookies file, when asked to
+func (conf *Configuration) StoreCookies() error {
+	if "" == conf.Cookies || !conf.SaveCookies {
+		return nil
 	}
-	return &pi, nil
+	return conf.Jar.Save(conf.Cookies)
 }
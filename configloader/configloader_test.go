@@ -2,18 +2,25 @@ package configloader_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+	"video-downloader/batch"
 	"video-downloader/configloader"
+	"video-downloader/downloader"
+	"video-downloader/httpclient"
 	"video-downloader/parsingelement"
 	"video-downloader/parsingelement/u"
+	"video-downloader/retry"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestReadConfig(t *testing.T) {
-	var pi *parsingelement.ParsingInformations
+	var pi *configloader.Configuration
 	var err error
 
 	// Wrong case - Path is empty
@@ -55,18 +62,125 @@ u:
         - "ht"
         - "htt"
         - "http"
-    query_key_url: "?:lic!"`
+    query_key_url: "?:lic!"
+    hosts:
+        - "*.u.test"
+    timeouts:
+        idle: 2m
+    http:
+        user_agent: "site agent"
+downloader:
+    segments: 4
+    min_segment_size: 1048576
+    output_template: "{site}/{id}.{ext}"
+    format: "best[height<=720][ext=mp4]/best"
+batch:
+    concurrency: 8
+    per_host: 2
+retry:
+    attempts: 5
+    initial_backoff: 500ms
+    max_backoff: 1m
+    retryable_status: [429, 503]
+timeouts:
+    connect: 10s
+    total: 1h
+http:
+    proxy: "socks5://localhost:1080"
+    headers:
+        referer: "https://u.test/"
+    max_redirects: 3
+cookies: "/tmp/cookies.txt"
+save_cookies: true`
 
 	confFileHandler.WriteString(conf)
 	pi, err = configloader.ReadConfig(confFilePath)
 
-	assert.Equal(t, &parsingelement.ParsingInformations{
-		&u.U{
-			UrlsInfos:       []string{"h", "ht", "htt", "http"},
-			Delimiter:       "uNQS1!",
-			Uid_size:        1,
-			QueryKeywordURL: "?:lic!",
-		},
-	}, pi)
+	retryPolicy := retry.Policy{
+		Attempts:        5,
+		InitialBackoff:  500 * time.Millisecond,
+		MaxBackoff:      time.Minute,
+		RetryableStatus: []int{429, 503},
+	}
 	assert.Nil(t, err)
+	assert.Equal(t, httpclient.Timeouts{Connect: 10 * time.Second, Total: time.Hour}, pi.Timeouts)
+	assert.Equal(t, httpclient.Options{
+		Proxy:        "socks5://localhost:1080",
+		Headers:      map[string]string{"referer": "https://u.test/"},
+		MaxRedirects: 3,
+		Jar:          pi.Jar,
+	}, pi.HTTP)
+	assert.Equal(t, "/tmp/cookies.txt", pi.Cookies)
+	assert.True(t, pi.SaveCookies)
+	assert.NotNil(t, pi.Jar)
+
+	// Clients are checked apart, they hold functions that can't be compared
+	extractor, exist := pi.ParsingInformations.Extractor("u")
+	assert.True(t, exist)
+	siteClient := pi.Downloader.SiteClients["u"]
+	if assert.NotNil(t, siteClient) {
+		assert.Equal(t, time.Hour, siteClient.Timeout)
+		assert.True(t, http.CookieJar(pi.Jar) == siteClient.Jar)
+		assert.Equal(t, siteClient, extractor.(*u.U).Client)
+	}
+	assert.Len(t, pi.Downloader.SiteClients, 1)
+	if assert.NotNil(t, pi.Downloader.Client) {
+		assert.Equal(t, time.Hour, pi.Downloader.Client.Timeout)
+		assert.True(t, http.CookieJar(pi.Jar) == pi.Downloader.Client.Jar)
+		assert.True(t, siteClient != pi.Downloader.Client)
+	}
+	extractor.(*u.U).Client = nil
+	pi.Downloader.Client = nil
+	pi.Downloader.SiteClients = nil
+
+	assert.Equal(t, &u.U{
+		UrlsInfos:       []string{"h", "ht", "htt", "http"},
+		Delimiter:       "uNQS1!",
+		UidSize:         1,
+		QueryKeywordURL: "?:lic!",
+		URLMatcher:      parsingelement.URLMatcher{Hosts: []string{"*.u.test"}},
+		Dependencies:    parsingelement.Dependencies{Retry: &retryPolicy},
+	}, extractor)
+	assert.Equal(t, downloader.Downloader{
+		Segments:       4,
+		MinSegmentSize: 1048576,
+		OutputTemplate: "{site}/{id}.{ext}",
+		Format:         "best[height<=720][ext=mp4]/best",
+		Retry:          &retryPolicy,
+	}, pi.Downloader)
+	assert.Equal(t, batch.Pool{Concurrency: 8, PerHost: 2}, pi.Batch)
+	assert.Equal(t, retryPolicy, pi.Retry)
+
+	// Wrong case - the proxy of a site is not supported
+	invalidConfPath := filepath.Join(pathToEmptyConf, "invalid.yml")
+	assert.Nil(t, ioutil.WriteFile(invalidConfPath, []byte("u:\n    http:\n        proxy: \"ftp://localhost\"\n"), 0666))
+	pi, err = configloader.ReadConfig(invalidConfPath)
+	assert.Nil(t, pi)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Invalid [u.http] section of configuration file")
+	}
+}
+
+func TestLoadCookies(t *testing.T) {
+	directory, err := ioutil.TempDir("", "cookies")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(directory)
+	cookiesPath := filepath.Join(directory, "cookies.txt")
+
+	// Wrong case - a missing file is an error when the cookies are only read
+	conf := &configloader.Configuration{Cookies: cookiesPath, Jar: httpclient.NewCookieJar()}
+	err = conf.LoadCookies()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Error opening cookies file")
+	}
+
+	// Right case - the first run saving the cookies creates the file
+	conf.SaveCookies = true
+	assert.Nil(t, conf.LoadCookies())
+	conf.Jar.Add([]*httpclient.Cookie{{Domain: "u.test", Path: "/", Name: "session", Value: "abc"}})
+	assert.Nil(t, conf.StoreCookies())
+	content, _ := ioutil.ReadFile(cookiesPath)
+	assert.Equal(t, "# Netscape HTTP Cookie File\nu.test\tFALSE\t/\tFALSE\t0\tsession\tabc\n", string(content))
 }
@@ -0,0 +1,167 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CollisionPolicy tells what to do when the generated filename already exists in the destination
+type CollisionPolicy string
+
+const (
+	// CollisionSuffix appends `_1`, `_2`, ... to the filename until a free one is found
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionSkip keeps the existing file and does not download the video
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionFail returns an error
+	CollisionFail CollisionPolicy = "fail"
+)
+
+// maxSuffix bounds the search of a free filename with CollisionSuffix
+const maxSuffix = 10000
+
+// Result describes what GetVideo did for a video
+type Result struct {
+	// Path is the file holding the video
+	Path string
+	// Policy is the collision policy applied
+	Policy CollisionPolicy
+	// Skipped is true when the file already existed and nothing was downloaded
+	Skipped bool
+	// Tracks are the files of the separate tracks of the video, Path being the first one. Empty
+	// when the video is a single file
+	Tracks []string
+	// MuxError is set when the tracks could not be muxed into a single file, they are kept
+	// as separate ones instead
+	MuxError error
+}
+
+// collisionPolicy - Returns the configured policy, CollisionSuffix when none is set
+func (d *Downloader) collisionPolicy() (CollisionPolicy, error) {
+	policy := CollisionPolicy(strings.ToLower(string(d.OnCollision)))
+	switch policy {
+	case "":
+		return CollisionSuffix, nil
+	case CollisionSuffix, CollisionSkip, CollisionOverwrite, CollisionFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown collision policy [%s]", d.OnCollision)
+	}
+}
+
+// resolveCollision - Returns the path where the video has to be written according to the policy.
+// An empty path with no error means the video must be skipped
+func resolveCollision(policy CollisionPolicy, path string) (string, error) {
+	if !fileExists(path) {
+		return path, nil
+	}
+
+	switch policy {
+	case CollisionSkip:
+		return "", nil
+	case CollisionOverwrite:
+		return path, nil
+	case CollisionFail:
+		return "", fmt.Errorf("Destination file [%s] already exists", path)
+	}
+
+	extension := filepath.Ext(path)
+	base := strings.TrimSuffix(path, extension)
+	for i := 1; i <= maxSuffix; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, extension)
+		if !fileExists(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("No free filename found for [%s]", path)
+}
+
+// fileExists - Check something exists at path
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return nil == err
+}
+
+// claimPath - Same as resolveCollision, but the path returned is created at once so no other
+// download, of this process or another one, can take it. Apart from CollisionOverwrite, the
+// caller must replace or remove it
+func claimPath(policy CollisionPolicy, path string) (string, error) {
+	if CollisionOverwrite == policy {
+		return path, nil
+	}
+
+	extension := filepath.Ext(path)
+	base := strings.TrimSuffix(path, extension)
+	candidate := path
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(candidate, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if nil == err {
+			return candidate, file.Close()
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+
+		switch {
+		case CollisionSkip == policy:
+			return "", nil
+		case CollisionFail == policy:
+			return "", fmt.Errorf("Destination file [%s] already exists", path)
+		case i > maxSuffix:
+			return "", fmt.Errorf("No free filename found for [%s]", path)
+		}
+		candidate = fmt.Sprintf("%s_%d%s", base, i, extension)
+	}
+}
+
+// moveToClaimed - Move the file at partialPath to the path claimed for it
+func moveToClaimed(policy CollisionPolicy, partialPath string, path string) error {
+	if err := os.Rename(partialPath, path); nil != err {
+		if CollisionOverwrite != policy {
+			os.Remove(path)
+		}
+		return errors.Wrapf(err, "Error moving [%s] to [%s]", partialPath, path)
+	}
+	return nil
+}
+
+// pathLocks serialises the downloads of a same final path, which a batch may run concurrently:
+// they would write the same partial file
+var pathLocks = struct {
+	sync.Mutex
+	locks map[string]*pathLock
+}{locks: map[string]*pathLock{}}
+
+type pathLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockPath - Wait until no other download of path runs, returns the function releasing it
+func lockPath(path string) func() {
+	pathLocks.Lock()
+	lock, exist := pathLocks.locks[path]
+	if !exist {
+		lock = &pathLock{}
+		pathLocks.locks[path] = lock
+	}
+	lock.users++
+	pathLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		pathLocks.Lock()
+		defer pathLocks.Unlock()
+		if lock.users--; 0 == lock.users {
+			delete(pathLocks.locks, path)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollisionPolicy(t *testing.T) {
+	policy, err := (&Downloader{}).collisionPolicy()
+	assert.Equal(t, CollisionSuffix, policy)
+	assert.Nil(t, err)
+
+	policy, err = (&Downloader{OnCollision: "Skip"}).collisionPolicy()
+	assert.Equal(t, CollisionSkip, policy)
+	assert.Nil(t, err)
+
+	policy, err = (&Downloader{OnCollision: "rename"}).collisionPolicy()
+	assert.Empty(t, policy)
+	assert.EqualError(t, err, "Unknown collision policy [rename]")
+}
+
+func TestResolveCollision(t *testing.T) {
+	destinationPath, err := ioutil.TempDir("", "collision")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	path := filepath.Join(destinationPath, "video.mp4")
+
+	// Right case - nothing exists, every policy keeps the name
+	for _, policy := range []CollisionPolicy{CollisionSuffix, CollisionSkip, CollisionOverwrite, CollisionFail} {
+		resolved, err := resolveCollision(policy, path)
+		assert.Equal(t, path, resolved)
+		assert.Nil(t, err)
+	}
+
+	ioutil.WriteFile(path, []byte("first"), 0666)
+	ioutil.WriteFile(filepath.Join(destinationPath, "video_1.mp4"), []byte("second"), 0666)
+
+	resolved, err := resolveCollision(CollisionSuffix, path)
+	assert.Equal(t, filepath.Join(destinationPath, "video_2.mp4"), resolved)
+	assert.Nil(t, err)
+
+	resolved, err = resolveCollision(CollisionOverwrite, path)
+	assert.Equal(t, path, resolved)
+	assert.Nil(t, err)
+
+	resolved, err = resolveCollision(CollisionSkip, path)
+	assert.Empty(t, resolved)
+	assert.Nil(t, err)
+
+	resolved, err = resolveCollision(CollisionFail, path)
+	assert.Empty(t, resolved)
+	assert.EqualError(t, err, fmt.Sprintf("Destination file [%s] already exists", path))
+}
+
+func TestGetVideoCollision(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("new video"))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "collision")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	path := filepath.Join(destinationPath, "same_title.mp4")
+	ioutil.WriteFile(path, []byte("old video"), 0666)
+	vi := &VideoInfos{URL: server.URL, Title: "Same title", Extension: ".mp4"}
+
+	// Skip - nothing is downloaded
+	result, err := (&Downloader{OnCollision: CollisionSkip}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: path, Policy: CollisionSkip, Skipped: true}, result)
+	assert.Equal(t, 0, requests)
+
+	// Fail - nothing is downloaded
+	result, err = (&Downloader{OnCollision: CollisionFail}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, fmt.Sprintf("Destination file [%s] already exists", path))
+	assert.Equal(t, 0, requests)
+
+	// Suffix - both videos are kept
+	result, err = (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: filepath.Join(destinationPath, "same_title_1.mp4"), Policy: CollisionSuffix}, result)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "old video", string(content))
+
+	// Overwrite
+	result, err = (&Downloader{OnCollision: CollisionOverwrite}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: path, Policy: CollisionOverwrite}, result)
+	content, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "new video", string(content))
+}
+
+func TestClaimPath(t *testing.T) {
+	destinationPath, err := ioutil.TempDir("", "claim")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	path := filepath.Join(destinationPath, "video.mp4")
+
+	// Right case - the name claimed is taken for the next claims
+	claimed, err := claimPath(CollisionSuffix, path)
+	assert.Equal(t, path, claimed)
+	assert.Nil(t, err)
+	assert.True(t, fileExists(path))
+	claimed, err = claimPath(CollisionSuffix, path)
+	assert.Equal(t, filepath.Join(destinationPath, "video_1.mp4"), claimed)
+	assert.Nil(t, err)
+
+	claimed, err = claimPath(CollisionOverwrite, path)
+	assert.Equal(t, path, claimed)
+	assert.Nil(t, err)
+
+	claimed, err = claimPath(CollisionSkip, path)
+	assert.Empty(t, claimed)
+	assert.Nil(t, err)
+
+	claimed, err = claimPath(CollisionFail, path)
+	assert.Empty(t, claimed)
+	assert.EqualError(t, err, fmt.Sprintf("Destination file [%s] already exists", path))
+}
+
+func TestGetVideoConcurrentCollision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("video " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "collision")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	// Right case - videos of a same name downloaded at the same time are all kept
+	const videos = 5
+	var wg sync.WaitGroup
+	errs := make([]error, videos)
+	for i := 0; i < videos; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vi := &VideoInfos{URL: fmt.Sprintf("%s/%d", server.URL, i), Title: "Same title", Extension: ".mp4"}
+			_, errs[i] = (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < videos; i++ {
+		assert.Nil(t, errs[i])
+	}
+	files, _ := ioutil.ReadDir(destinationPath)
+	contents := map[string]bool{}
+	for _, file := range files {
+		content, _ := ioutil.ReadFile(filepath.Join(destinationPath, file.Name()))
+		contents[string(content)] = true
+	}
+	assert.Len(t, files, videos)
+	assert.Len(t, contents, videos)
+	assert.Empty(t, pathLocks.locks)
+}
@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ContentTypeCheck tells what to do when the served content type does not match the video extension
+type ContentTypeCheck string
+
+const (
+	// ContentTypeOff does not look at the content type
+	ContentTypeOff ContentTypeCheck = "off"
+	// ContentTypeWarn logs a mismatch and downloads anyway
+	ContentTypeWarn ContentTypeCheck = "warn"
+	// ContentTypeStrict refuses to download on a mismatch
+	ContentTypeStrict ContentTypeCheck = "strict"
+)
+
+// ContentTypeError is returned in strict mode when the server serves something else than the video
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+	Extension   string
+}
+
+func (cte *ContentTypeError) Error() string {
+	return fmt.Sprintf("Content type [%s] served for [%s] does not match extension [%s]", cte.ContentType, cte.URL, cte.Extension)
+}
+
+// contentTypeCheck - Returns the configured check, ContentTypeOff when none is set
+func (d *Downloader) contentTypeCheck() (ContentTypeCheck, error) {
+	check := ContentTypeCheck(strings.ToLower(string(d.ContentTypeCheck)))
+	switch check {
+	case "":
+		return ContentTypeOff, nil
+	case ContentTypeOff, ContentTypeWarn, ContentTypeStrict:
+		return check, nil
+	default:
+		return "", fmt.Errorf("Unknown content type check [%s]", d.ContentTypeCheck)
+	}
+}
+
+// checkContentType - Compare the content type of resp with the expected extension, according to
+// the configured check
+func (d *Downloader) checkContentType(resp *http.Response, extension string) error {
+	check, err := d.contentTypeCheck()
+	if nil != err || ContentTypeOff == check {
+		return err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if matchContentType(contentType, extension) {
+		return nil
+	}
+	mismatch := &ContentTypeError{URL: resp.Request.URL.String(), ContentType: contentType, Extension: extension}
+	if ContentTypeStrict == check {
+		return mismatch
+	}
+	logrus.Warnf("%v, download it anyway", mismatch)
+	return nil
+}
+
+// matchContentType - Check contentType may hold a file of the given extension, according to the
+// built in media types table. Generic binary types, types and extensions missing from the table
+// can't be checked, they match anything but text pages
+func matchContentType(contentType string, extension string) bool {
+	if "" == contentType || "" == extension {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if nil != err {
+		return false
+	}
+	if "application/octet-stream" == mediaType || "binary/octet-stream" == mediaType {
+		return true
+	}
+
+	extension = strings.ToLower(extension)
+	if !strings.HasPrefix(extension, ".") {
+		extension = "." + extension
+	}
+	extensions, knownType := mediaTypes[mediaType]
+	if !knownType || !isMediaExtension(extension) {
+		return !isTextType(mediaType)
+	}
+	for _, served := range extensions {
+		if served == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextType - Check mediaType is an error page or a document rather than a media
+func isTextType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || "application/json" == mediaType || "application/xml" == mediaType
+}
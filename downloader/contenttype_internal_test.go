@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"video-downloader/retry"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchContentType(t *testing.T) {
+	cases := map[[2]string]bool{
+		{"video/mp4", ".mp4"}:                      true,
+		{"video/mp4; codecs=\"avc1\"", "mp4"}:      true,
+		{"application/octet-stream", ".mp4"}:       true,
+		{"", ".mp4"}:                               true,
+		{"video/mp4", ""}:                          true,
+		{"text/html; charset=utf-8", ".mp4"}:       false,
+		{"application/json", ".webm"}:              false,
+		{"text/html", ".unknownextension"}:         false,
+		{"video/whatever", ".unknownextension"}:    true,
+		{"not a / valid ; = content type", ".mp4"}: false,
+		// Only the built in table is used, whatever the mime files of the system
+		{"video/webm", ".mp4"}:       false,
+		{"video/mp4", ".webm"}:       false,
+		{"audio/mpeg", ".m4a"}:       false,
+		{"video/x-flv", ".flv"}:      true,
+		{"video/mp4", ".M4V"}:        true,
+		{"audio/mp4", ".mp4"}:        true,
+		{"video/x-matroska", ".mkv"}: true,
+		{"text/plain", ".mkv"}:       false,
+		{"video/mp2t", ".unknown"}:   true,
+	}
+
+	for values, expected := range cases {
+		assert.Equal(t, expected, matchContentType(values[0], values[1]), "%v", values)
+	}
+}
+
+func TestGetVideoValidation(t *testing.T) {
+	status := http.StatusOK
+	contentType := "text/html; charset=utf-8"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte("<html>error page</html>"))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "validation")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+	vi := &VideoInfos{URL: server.URL, Title: "validated", Extension: ".mp4"}
+	path := filepath.Join(destinationPath, "validated.mp4")
+
+	// Wrong case - strict mode refuses an HTML page
+	d := &Downloader{ContentTypeCheck: ContentTypeStrict}
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.Equal(t, &ContentTypeError{URL: server.URL, ContentType: contentType, Extension: ".mp4"}, err)
+	assert.False(t, fileExists(path))
+	assert.False(t, fileExists(path+partialSuffix))
+
+	// Right case - warn mode downloads it anyway
+	d.ContentTypeCheck = ContentTypeWarn
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, path, result.Path)
+
+	// Wrong case - non 2xx are always refused
+	status = http.StatusForbidden
+	result, err = (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.Equal(t, &retry.StatusError{URL: server.URL, StatusCode: 403, Status: "403 Forbidden"}, err)
+
+	// Wrong case - unknown check
+	result, err = (&Downloader{ContentTypeCheck: "maybe"}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, fmt.Sprintf("Unknown content type check [%s]", "maybe"))
+}
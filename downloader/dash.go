@@ -0,0 +1,192 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxManifestSize bounds the amount of bytes read from a DASH manifest
+const maxManifestSize = 10 * 1024 * 1024
+
+// DASHSettings contains the settings used to fetch DASH streams
+type DASHSettings struct {
+	// Concurrency is the number of segments fetched at the same time, 4 by default
+	Concurrency int `mapstructure:"concurrency"`
+	// MaxHeight excludes the video representations of a higher resolution, 0 keeps them all
+	MaxHeight int `mapstructure:"max_height"`
+	// MaxBandwidth excludes the video representations of a higher bandwidth, in bits per second,
+	// 0 keeps them all
+	MaxBandwidth int64 `mapstructure:"max_bandwidth"`
+	// VideoCodecs are the preferred video codecs, in order, eg `[avc1, hev1]`. A codec matches the
+	// representations whose codecs start with it; when none matches, any codec is taken
+	VideoCodecs []string `mapstructure:"video_codecs"`
+	// AudioCodecs are the preferred audio codecs, in order, eg `[mp4a, opus]`
+	AudioCodecs []string `mapstructure:"audio_codecs"`
+}
+
+// Track is a stream of a video delivered apart from the others, such as the video and the audio
+// of a DASH manifest
+type Track struct {
+	URL       string `json:"url"`
+	Extension string `json:"extension"`
+	// Those are optional, they describe the quality of the track
+	Codecs    string `json:"codecs,omitempty"`
+	Bandwidth int64  `json:"bandwidth,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+// isDASH - Check the video is a DASH manifest rather than a media file
+func isDASH(vi *VideoInfos) bool {
+	if strings.EqualFold(strings.TrimPrefix(vi.Extension, "."), "mpd") {
+		return true
+	}
+	parsed, err := url.Parse(vi.URL)
+	return nil == err && strings.EqualFold(path.Ext(parsed.Path), ".mpd")
+}
+
+// getDASH - Download the video and audio representations selected in the manifest of vi, each one
+// in its own file
+func (d *Downloader) getDASH(ctx context.Context, vi *VideoInfos, destinationPath string, policy CollisionPolicy) (*Result, error) {
+	representations, manifestURL, err := d.fetchManifest(ctx, vi.URL)
+	if nil != err {
+		return nil, err
+	}
+	video, audio := d.DASH.selectRepresentations(representations)
+	if nil == video && nil == audio {
+		return nil, fmt.Errorf("No representation found in DASH manifest [%s]", manifestURL)
+	}
+
+	var tracks []trackFile
+	for _, selected := range []*dashRepresentation{video, audio} {
+		if nil == selected {
+			continue
+		}
+		logrus.Debugf("Selected DASH representation [%s] of codecs [%s], bandwidth [%d] and resolution [%dx%d]", selected.ID, selected.Codecs, selected.Bandwidth, selected.Width, selected.Height)
+		representation := selected
+		sourceURL := manifestURL + "#" + representation.ID
+		tracks = append(tracks, trackFile{
+			kind:      trackKind(representation.isVideo()),
+			extension: representation.extension(),
+			sourceURL: sourceURL,
+			fetch: func(ctx context.Context, partialPath string, tracker *progressTracker) (int64, error) {
+				return d.downloadSegmentedStream(ctx, sourceURL, representation.Segments, d.DASH.Concurrency, partialPath, tracker)
+			},
+		})
+	}
+	return d.getTracks(ctx, vi, destinationPath, policy, tracks)
+}
+
+// fetchManifest - Fetch and parse the DASH manifest at manifestURL. Returns its representations and
+// the URL it was served from
+func (d *Downloader) fetchManifest(ctx context.Context, manifestURL string) ([]dashRepresentation, string, error) {
+	var content []byte
+	var base *url.URL
+	err := d.Retry.DoContext(ctx, fmt.Sprintf("fetching manifest [%s]", manifestURL), func() error {
+		req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating request for manifest [%s]", manifestURL)
+		}
+		resp, err := d.httpClient().Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error fetching manifest [%s]", manifestURL)
+		}
+		defer resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+		if content, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize)); nil != err {
+			return errors.Wrapf(err, "Error reading manifest [%s]", manifestURL)
+		}
+		base = resp.Request.URL
+		return nil
+	})
+	if nil != err {
+		return nil, "", err
+	}
+
+	representations, err := parseMPD(content, base)
+	if nil != err {
+		return nil, "", errors.Wrapf(err, "Error parsing manifest [%s]", manifestURL)
+	}
+	return representations, base.String(), nil
+}
+
+// selectRepresentations - Returns the best video and audio representations, nil when the
+// manifest has none of the kind. Other kinds, such as subtitles or thumbnails, are ignored
+func (ds *DASHSettings) selectRepresentations(representations []dashRepresentation) (*dashRepresentation, *dashRepresentation) {
+	var videos, audios []*dashRepresentation
+	for i := range representations {
+		switch {
+		case representations[i].isVideo():
+			videos = append(videos, &representations[i])
+		case representations[i].isAudio():
+			audios = append(audios, &representations[i])
+		}
+	}
+
+	var withinLimits []*dashRepresentation
+	for _, video := range videos {
+		if (ds.MaxHeight > 0 && video.Height > ds.MaxHeight) || (ds.MaxBandwidth > 0 && video.Bandwidth > ds.MaxBandwidth) {
+			continue
+		}
+		withinLimits = append(withinLimits, video)
+	}
+	var video *dashRepresentation
+	if 0 == len(withinLimits) && len(videos) > 0 {
+		logrus.Warnf("No DASH representation within height [%d] and bandwidth [%d], use the lowest one", ds.MaxHeight, ds.MaxBandwidth)
+		for _, candidate := range videos {
+			if nil == video || candidate.Bandwidth < video.Bandwidth {
+				video = candidate
+			}
+		}
+	} else {
+		video = bestRepresentation(preferCodecs(withinLimits, ds.VideoCodecs))
+	}
+	return video, bestRepresentation(preferCodecs(audios, ds.AudioCodecs))
+}
+
+// preferCodecs - Returns the representations of the first preferred codec available, all of them
+// when none is
+func preferCodecs(representations []*dashRepresentation, codecs []string) []*dashRepresentation {
+	for _, codec := range codecs {
+		var matching []*dashRepresentation
+		for _, representation := range representations {
+			if strings.HasPrefix(strings.ToLower(representation.Codecs), strings.ToLower(codec)) {
+				matching = append(matching, representation)
+			}
+		}
+		if len(matching) > 0 {
+			return matching
+		}
+	}
+	return representations
+}
+
+// bestRepresentation - Returns the representation of highest bandwidth, then resolution
+func bestRepresentation(representations []*dashRepresentation) *dashRepresentation {
+	var best *dashRepresentation
+	for _, representation := range representations {
+		if nil == best || representation.Bandwidth > best.Bandwidth || (representation.Bandwidth == best.Bandwidth && representation.Height > best.Height) {
+			best = representation
+		}
+	}
+	return best
+}
+
+func trackKind(video bool) string {
+	if video {
+		return "video"
+	}
+	return "audio"
+}
@@ -0,0 +1,199 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"video-downloader/mp4mux"
+	"video-downloader/internal/mp4muxtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectRepresentations(t *testing.T) {
+	representations := []dashRepresentation{
+		{ID: "avc-360", MimeType: "video/mp4", Codecs: "avc1.4d401e", Bandwidth: 800, Height: 360},
+		{ID: "avc-720", MimeType: "video/mp4", Codecs: "avc1.64001f", Bandwidth: 2400, Height: 720},
+		{ID: "vp9-720", MimeType: "video/webm", Codecs: "vp09.00.31.08", Bandwidth: 1800, Height: 720},
+		{ID: "av1-1080", MimeType: "video/mp4", Codecs: "av01.0.08M.08", Bandwidth: 4000, Height: 1080},
+		{ID: "aac-128", MimeType: "audio/mp4", Codecs: "mp4a.40.2", Bandwidth: 128},
+		{ID: "opus-160", MimeType: "audio/webm", Codecs: "opus", Bandwidth: 160},
+		{ID: "vtt", MimeType: "text/vtt", Bandwidth: 1000},
+		{ID: "ttml", MimeType: "application/ttml+xml", Bandwidth: 1000},
+		{ID: "thumbnails", MimeType: "image/jpeg", Bandwidth: 5000, Width: 3840, Height: 2160},
+	}
+
+	cases := []struct {
+		settings     DASHSettings
+		video, audio string
+	}{
+		{DASHSettings{}, "av1-1080", "opus-160"},
+		{DASHSettings{MaxHeight: 720}, "avc-720", "opus-160"},
+		{DASHSettings{MaxHeight: 720, VideoCodecs: []string{"vp09", "avc1"}, AudioCodecs: []string{"MP4A"}}, "vp9-720", "aac-128"},
+		{DASHSettings{MaxBandwidth: 1000, VideoCodecs: []string{"hev1"}}, "avc-360", "opus-160"},
+		{DASHSettings{MaxHeight: 100}, "avc-360", "opus-160"},
+	}
+	for _, c := range cases {
+		video, audio := c.settings.selectRepresentations(representations)
+		assert.Equal(t, c.video, video.ID, "%+v", c.settings)
+		assert.Equal(t, c.audio, audio.ID, "%+v", c.settings)
+	}
+
+	video, audio := (&DASHSettings{}).selectRepresentations(representations[4:])
+	assert.Nil(t, video)
+	assert.Equal(t, "opus-160", audio.ID)
+
+	// Subtitles and thumbnails are neither video nor audio
+	video, audio = (&DASHSettings{}).selectRepresentations(representations[6:])
+	assert.Nil(t, video)
+	assert.Nil(t, audio)
+	video, audio = (&DASHSettings{}).selectRepresentations(append([]dashRepresentation{representations[0]}, representations[6:]...))
+	assert.Equal(t, "avc-360", video.ID)
+	assert.Nil(t, audio)
+}
+
+func TestGetVideoDASH(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.mpd":
+			fmt.Fprint(w, `<MPD mediaPresentationDuration="PT4S"><Period>
+				<AdaptationSet mimeType="video/mp4">
+					<SegmentTemplate initialization="$RepresentationID$-init" media="$RepresentationID$-$Number$" duration="2"/>
+					<Representation id="low" bandwidth="100" height="144"/>
+					<Representation id="high" bandwidth="900" height="720"/>
+				</AdaptationSet>
+				<AdaptationSet mimeType="audio/mp4"><Representation id="audio" bandwidth="64"><BaseURL>audio.m4a</BaseURL></Representation></AdaptationSet>
+				<AdaptationSet contentType="text" mimeType="text/vtt"><Representation id="subtitles" bandwidth="1000"><BaseURL>subtitles.vtt</BaseURL></Representation></AdaptationSet>
+			</Period></MPD>`)
+		case "/no-audio.mpd":
+			fmt.Fprint(w, `<MPD><Period>
+				<AdaptationSet mimeType="video/mp4"><Representation id="video" bandwidth="900" height="720"><BaseURL>video.mp4</BaseURL></Representation></AdaptationSet>
+				<AdaptationSet contentType="text" mimeType="application/ttml+xml"><Representation id="subtitles" bandwidth="1000"><BaseURL>subtitles.ttml</BaseURL></Representation></AdaptationSet>
+				<AdaptationSet contentType="image" mimeType="image/jpeg"><Representation id="thumbnails" bandwidth="5000" width="1280" height="720"><BaseURL>thumbnails.jpg</BaseURL></Representation></AdaptationSet>
+			</Period></MPD>`)
+		case "/audio-only.mpd":
+			fmt.Fprint(w, `<MPD><Period><AdaptationSet mimeType="audio/mp4"><Representation id="audio" bandwidth="64"><BaseURL>audio.m4a</BaseURL></Representation></AdaptationSet></Period></MPD>`)
+		case "/high-init", "/high-1", "/high-2", "/audio.m4a", "/video.mp4":
+			fmt.Fprint(w, r.URL.Path[1:]+";")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "dash")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{KeepTracks: true}
+	result, err := d.GetVideo(context.Background(), &VideoInfos{URL: server.URL + "/manifest.mpd", Title: "movie", Extension: ".mpd"}, destinationPath)
+	assert.Nil(t, err)
+	videoPath := filepath.Join(destinationPath, "movie.video.mp4")
+	audioPath := filepath.Join(destinationPath, "movie.audio.m4a")
+	assert.Equal(t, &Result{Path: videoPath, Policy: CollisionSuffix, Tracks: []string{videoPath, audioPath}}, result)
+	content, _ := ioutil.ReadFile(videoPath)
+	assert.Equal(t, "high-init;high-1;high-2;", string(content))
+	content, _ = ioutil.ReadFile(audioPath)
+	assert.Equal(t, "audio.m4a;", string(content))
+
+	// A single track takes the name of the video
+	result, err = d.GetVideo(context.Background(), &VideoInfos{URL: server.URL + "/audio-only.mpd", Title: "song"}, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: filepath.Join(destinationPath, "song.m4a"), Policy: CollisionSuffix}, result)
+
+	// Subtitles and thumbnails are not taken for the audio track
+	result, err = d.GetVideo(context.Background(), &VideoInfos{URL: server.URL + "/no-audio.mpd", Title: "clip"}, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: filepath.Join(destinationPath, "clip.mp4"), Policy: CollisionSuffix}, result)
+	content, _ = ioutil.ReadFile(filepath.Join(destinationPath, "clip.mp4"))
+	assert.Equal(t, "video.mp4;", string(content))
+
+	// Tracks given by the extractor
+	d.OnCollision = CollisionSkip
+	vi := &VideoInfos{
+		Title: "movie",
+		Video: &Track{URL: server.URL + "/video.mp4", Extension: ".mp4"},
+		Audio: &Track{URL: server.URL + "/audio.m4a", Extension: ".m4a"},
+	}
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: videoPath, Policy: CollisionSkip, Skipped: true, Tracks: []string{videoPath, audioPath}}, result)
+
+	os.Remove(audioPath)
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: videoPath, Policy: CollisionSkip, Tracks: []string{videoPath, audioPath}}, result)
+
+	// MP4 tracks whose content is not a fragmented MP4 fail to mux, they are kept and the failure
+	// reported. The track file left by the previous run is not replaced
+	os.Remove(videoPath)
+	d.KeepTracks = false
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	if assert.NotNil(t, result) && assert.NotNil(t, result.MuxError) {
+		assert.Contains(t, result.MuxError.Error(), "Error parsing input [0]")
+		assert.Equal(t, &Result{Path: videoPath, Policy: CollisionSkip, Tracks: []string{videoPath, audioPath}, MuxError: result.MuxError}, result)
+	}
+	content, _ = ioutil.ReadFile(videoPath)
+	assert.Equal(t, "video.mp4;", string(content))
+	files, _ := filepath.Glob(filepath.Join(destinationPath, "movie*"+partialSuffix))
+	assert.Empty(t, files)
+
+	result, err = d.GetVideo(context.Background(), &VideoInfos{URL: server.URL + "/missing.mpd", Title: "missing"}, destinationPath)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, fmt.Sprintf("Server answered [404 Not Found] for [%s/missing.mpd]", server.URL))
+}
+
+func TestGetVideoMuxed(t *testing.T) {
+	video := mp4muxtest.FragmentedMP4(1, "vide", 90000, []uint64{0, 180000}, []string{"v0", "v1"})
+	audio := mp4muxtest.FragmentedMP4(1, "soun", 48000, []uint64{0, 96000}, []string{"a0", "a1"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/video.mp4":
+			w.Write(video)
+		case "/audio.m4a":
+			w.Write(audio)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "muxed")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	// A file of the user named as a track is left untouched
+	userTrackPath := filepath.Join(destinationPath, "movie.video.mp4")
+	assert.Nil(t, ioutil.WriteFile(userTrackPath, []byte("user file"), 0666))
+
+	vi := &VideoInfos{
+		Title: "movie",
+		Video: &Track{URL: server.URL + "/video.mp4", Extension: ".mp4"},
+		Audio: &Track{URL: server.URL + "/audio.m4a", Extension: ".m4a"},
+	}
+	result, err := (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	muxedPath := filepath.Join(destinationPath, "movie.mp4")
+	assert.Equal(t, &Result{Path: muxedPath, Policy: CollisionSuffix}, result)
+
+	var expected bytes.Buffer
+	assert.Nil(t, mp4mux.Mux(&expected, bytes.NewReader(video), bytes.NewReader(audio)))
+	content, _ := ioutil.ReadFile(muxedPath)
+	assert.Equal(t, expected.Bytes(), content)
+
+	content, _ = ioutil.ReadFile(userTrackPath)
+	assert.Equal(t, "user file", string(content))
+	files, _ := ioutil.ReadDir(destinationPath)
+	assert.Len(t, files, 2)
+}
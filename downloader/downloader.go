@@ -1,84 +1,502 @@
 package downloader
 
 import (
-	"io/ioutil"
-	"log"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"video-downloader/retry"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// copyBufferSize is the size of the buffer used to stream a response body to disk,
+// memory used by a download stays bounded by it whatever the video size is
+const copyBufferSize = 32 * 1024
+
+// Downloader contains the settings used to fetch videos. The zero value downloads every video
+// with a single connection. The structure can be accessed concurrently by many goroutines
+type Downloader struct {
+	// Segments is the number of connections used to fetch a single video, when the server accepts ranges
+	Segments int `mapstructure:"segments"`
+	// MinSegmentSize is the smallest amount of bytes fetched by one connection
+	MinSegmentSize int64 `mapstructure:"min_segment_size"`
+	// OnCollision is the policy applied when the video file already exists, `suffix` by default
+	OnCollision CollisionPolicy `mapstructure:"on_collision"`
+	// OutputTemplate builds the video path from its informations, eg `{site}/{id}.{ext}`.
+	// When empty the lowercased title is used
+	OutputTemplate string `mapstructure:"output_template"`
+	// Progress, when set, receives the progress of every download
+	Progress ProgressFunc `mapstructure:"-"`
+	// ContentTypeCheck compares the served content type with the video extension, `off` by default
+	ContentTypeCheck ContentTypeCheck `mapstructure:"content_type_check"`
+	// HLS contains the settings used when the video is a HLS playlist
+	HLS HLSSettings `mapstructure:"hls"`
+	// DASH contains the settings used when the video is a DASH manifest
+	DASH DASHSettings `mapstructure:"dash"`
+	// Format selects the format downloaded when the site offers many, eg `best[height<=720][ext=mp4]`,
+	// `best` by default. See SelectFormat
+	Format string `mapstructure:"format"`
+	// KeepTracks writes separate MP4 video and audio tracks to their own files rather than muxing
+	// them into a single MP4 file
+	KeepTracks bool `mapstructure:"keep_tracks"`
+	// Retry is the policy applied to failing requests, nil never retries
+	Retry *retry.Policy `mapstructure:"-"`
+	// Client sends every request, http.DefaultClient when nil
+	Client *http.Client `mapstructure:"-"`
+	// SiteClients replace Client for the videos of a site, by site name
+	SiteClients map[string]*http.Client `mapstructure:"-"`
+}
+
 type VideoInfos struct {
-	URL       string
-	Extension string
-	Title     string
+	URL       string `json:"url"`
+	Extension string `json:"extension"`
+	Title     string `json:"title"`
+	// Those are optional, extractors fill what the site gives
+	ID       string `json:"id,omitempty"`
+	Site     string `json:"site,omitempty"`
+	Uploader string `json:"uploader,omitempty"`
+	// Date is the upload date, formatted as YYYYMMDD
+	Date string `json:"date,omitempty"`
+	// Duration is the length of the video in seconds, 0 when unknown
+	Duration float64 `json:"duration,omitempty"`
+	// Video and Audio are set when the site delivers them as separate streams, URL is then unused.
+	// They are muxed into a single file when possible
+	Video *Track `json:"video,omitempty"`
+	Audio *Track `json:"audio,omitempty"`
+	// Formats are every stream the site offers for the video. When set, the one picked by the
+	// Downloader format replaces URL and Extension
+	Formats []Format `json:"formats,omitempty"`
 }
 
-// Based on information filled, attempt to dynamically create video filename
+// Based on information filled, attempt to dynamically create video filename.
+// The title falls back to the video ID when nothing usable is left once sanitised
 func generateVideoFilename(vi *VideoInfos) (string, error) {
 	if nil == vi {
 		return "", errors.New("Uninitalized parameters provided")
 	}
 
-	if vi.Title != "" && vi.Extension != "" {
-		reg, err := regexp.Compile("[^a-zA-Z0-9_ ]+")
-		if err != nil {
-			log.Fatal(err)
-		}
-		replaceCharacterForbidden := reg.ReplaceAllString(vi.Title, "")
-		slicedTitle := strings.Split(strings.ToLower(replaceCharacterForbidden), " ")
-		if strings.HasPrefix(vi.Extension, ".") {
-			return strings.Join(slicedTitle, "_") + vi.Extension, nil
-		} else {
-			return strings.Join(slicedTitle, "_") + "." + vi.Extension, nil
-		}
+	title := sanitizeFilename(vi.Title)
+	if "" == title {
+		title = sanitizeFilename(vi.ID)
+	}
+	extension := sanitizeFilename(strings.TrimPrefix(vi.Extension, "."))
+	if title != "" && extension != "" {
+		slicedTitle := strings.Split(strings.ToLower(title), " ")
+		return truncateFilename(strings.Join(slicedTitle, "_")+"."+extension, maxFilenameBytes), nil
 	}
 
 	return "", errors.New("No enough information to create video filename")
 }
 
-// GetVideo - effectively download the video once we got the right videoInfo
-func GetVideo(vi *VideoInfos, destinationPath string) (string, error) {
+// videoFilename - Returns the path of the video relative to the destination
+func (d *Downloader) videoFilename(vi *VideoInfos) (string, error) {
+	if "" != d.OutputTemplate {
+		return renderOutputTemplate(d.OutputTemplate, vi)
+	}
+	return generateVideoFilename(vi)
+}
+
+// httpClient - Returns the client sending the requests
+func (d *Downloader) httpClient() *http.Client {
+	if nil == d.Client {
+		return http.DefaultClient
+	}
+	return d.Client
+}
+
+// forSite - Returns the downloader of the videos of site, the one using its client
+func (d *Downloader) forSite(site string) *Downloader {
+	client, exist := d.SiteClients[site]
+	if !exist {
+		return d
+	}
+	siteDownloader := *d
+	siteDownloader.Client = client
+	return &siteDownloader
+}
+
+// GetVideo - effectively download the video once we got the right videoInfo.
+// The video is written to a `.part` file in destinationPath and only renamed to its final name once
+// complete. When the transfer dies, the next run on the same URL asks the server for the remaining
+// bytes only; when it can't be resumed, the partial file is removed.
+// HLS playlists are downloaded segment by segment and written as a single `.ts` file. DASH
+// manifests and separate tracks are muxed into a single `.mp4` file when they are MP4 ones, and
+// written as one file per track otherwise. When the site offers many formats, the one selected by
+// Format is downloaded.
+// Once ctx is done every request is stopped and the partial files are removed
+func (d *Downloader) GetVideo(ctx context.Context, vi *VideoInfos, destinationPath string) (*Result, error) {
 	if nil == vi {
-		return "", errors.New("Nil videoInfo passed in argument to 'getVideo'")
+		return nil, errors.New("Nil videoInfo passed in argument to 'getVideo'")
+	}
+	d = d.forSite(vi.Site)
+	if len(vi.Formats) > 0 {
+		format, err := SelectFormat(vi.Formats, d.Format)
+		if nil != err {
+			return nil, err
+		}
+		logrus.Debugf("Selected format [%s] of type [%s], resolution [%dx%d] and bitrate [%d]", format.ID, format.MimeType, format.Width, format.Height, format.Bitrate)
+		selected := *vi
+		selected.URL, selected.Extension = format.URL, format.Extension
+		vi = &selected
 	}
 	videoURL := vi.URL
-	if "" == videoURL {
-		return "", errors.New("Empty video URL on 'getVideo'")
+	if "" == videoURL && nil == vi.Video && nil == vi.Audio {
+		return nil, errors.New("Empty video URL on 'getVideo'")
+	}
+	policy, err := d.collisionPolicy()
+	if nil != err {
+		return nil, err
+	}
+	if _, err = d.contentTypeCheck(); nil != err {
+		return nil, err
 	}
 
-	resp, err := http.Get(videoURL)
+	switch {
+	case nil != vi.Video || nil != vi.Audio:
+		var tracks []trackFile
+		for _, track := range []*Track{vi.Video, vi.Audio} {
+			if nil == track {
+				continue
+			}
+			track := track
+			tracks = append(tracks, trackFile{
+				kind:      trackKind(track == vi.Video),
+				extension: track.Extension,
+				sourceURL: track.URL,
+				fetch: func(ctx context.Context, partialPath string, tracker *progressTracker) (int64, error) {
+					return d.download(ctx, track.URL, track.Extension, partialPath, tracker)
+				},
+			})
+		}
+		return d.getTracks(ctx, vi, destinationPath, policy, tracks)
+	case isDASH(vi):
+		return d.getDASH(ctx, vi, destinationPath, policy)
+	case isHLS(vi):
+		tsInfos := *vi
+		tsInfos.Extension = hlsExtension
+		finalPath, err := d.finalPath(&tsInfos, destinationPath)
+		if nil != err {
+			return nil, err
+		}
+		return d.getFile(ctx, videoURL, finalPath, policy, func(ctx context.Context, partialPath string, tracker *progressTracker) (int64, error) {
+			return d.downloadHLS(ctx, videoURL, partialPath, tracker)
+		})
+	}
 
+	finalPath, err := d.finalPath(vi, destinationPath)
 	if nil != err {
-		return "", errors.Wrapf(err, "Error fetching content [%s]", videoURL)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return d.getFile(ctx, videoURL, finalPath, policy, func(ctx context.Context, partialPath string, tracker *progressTracker) (int64, error) {
+		return d.download(ctx, videoURL, vi.Extension, partialPath, tracker)
+	})
+}
 
-	var content []byte
-	if content, err = ioutil.ReadAll(resp.Body); nil != err {
-		return "", errors.Wrapf(err, "Error reading response of [%s]", videoURL)
-	}
+// fetchFunc writes a video or a track into partialPath. Returns the size it must have, -1 when unknown
+type fetchFunc func(ctx context.Context, partialPath string, tracker *progressTracker) (int64, error)
+
+// trackFile describes a track written to its own file, next to the other tracks of the video
+type trackFile struct {
+	// kind is `video` or `audio`, it's appended to the video filename
+	kind      string
+	extension string
+	sourceURL string
+	fetch     fetchFunc
+}
 
-	var file *os.File
-	var filename string
-	if filename, err = generateVideoFilename(vi); nil != err {
+// finalPath - Returns the path of the video in destinationPath, its directory created
+func (d *Downloader) finalPath(vi *VideoInfos, destinationPath string) (string, error) {
+	filename, err := d.videoFilename(vi)
+	if nil != err {
 		return "", errors.Wrap(err, "Error generating filename")
 	}
 	logrus.Debugf("generate file name [%s]", filename)
-	file, err = os.OpenFile(filepath.Join(destinationPath, filename), os.O_CREATE|os.O_RDWR, 0777)
+	finalPath := filepath.Join(destinationPath, filename)
+	if err = os.MkdirAll(filepath.Dir(finalPath), 0777); nil != err {
+		return "", errors.Wrapf(err, "Error creating directory of [%s]", finalPath)
+	}
+	return finalPath, nil
+}
+
+// getTracks - Download every track in its own file, named after the video with the kind of the
+// track appended, eg `title.video.webm` and `title.audio.weba`. A single track takes the video
+// name, MP4 tracks are muxed unless KeepTracks is set. The Result Path is the first track
+func (d *Downloader) getTracks(ctx context.Context, vi *VideoInfos, destinationPath string, policy CollisionPolicy, tracks []trackFile) (*Result, error) {
+	if 0 == len(tracks) {
+		return nil, errors.New("No track to download")
+	}
+	firstInfos := *vi
+	firstInfos.Extension = tracks[0].extension
+	finalPath, err := d.finalPath(&firstInfos, destinationPath)
+	if nil != err {
+		return nil, err
+	}
+	if 1 == len(tracks) {
+		return d.getFile(ctx, tracks[0].sourceURL, finalPath, policy, tracks[0].fetch)
+	}
+	if !d.KeepTracks {
+		if muxable(tracks) {
+			return d.getMuxedTracks(ctx, vi, destinationPath, policy, tracks)
+		}
+		logrus.Infof("Tracks of [%s] are not MP4 ones, they are written as separate files", finalPath)
+	}
+
+	base := strings.TrimSuffix(finalPath, filepath.Ext(finalPath))
+	result := &Result{Policy: policy, Skipped: true}
+	for _, track := range tracks {
+		trackResult, err := d.getFile(ctx, track.sourceURL, base+"."+track.kind+track.extension, policy, track.fetch)
+		if nil != err {
+			return nil, errors.Wrapf(err, "Error downloading %s track", track.kind)
+		}
+		result.Tracks = append(result.Tracks, trackResult.Path)
+		result.Skipped = result.Skipped && trackResult.Skipped
+	}
+	result.Path = result.Tracks[0]
+	return result, nil
+}
+
+// getFile - Write what fetch downloads from sourceURL at finalPath, according to the collision policy
+func (d *Downloader) getFile(ctx context.Context, sourceURL string, finalPath string, policy CollisionPolicy, fetch fetchFunc) (*Result, error) {
+	defer lockPath(finalPath)()
+	partialPath := finalPath + partialSuffix
+
+	// Don't download anything when the result is known in advance
+	if CollisionSkip == policy || CollisionFail == policy {
+		path, err := resolveCollision(policy, finalPath)
+		if nil != err {
+			return nil, err
+		}
+		if "" == path {
+			logrus.Infof("File [%s] already exists, skip [%s]", finalPath, sourceURL)
+			return &Result{Path: finalPath, Policy: policy, Skipped: true}, nil
+		}
+	}
+
+	tracker := newProgressTracker(d.Progress, finalPath)
+	expectedSize, err := fetch(ctx, partialPath, tracker)
+	if nil == err {
+		err = verifySize(partialPath, expectedSize)
+	}
+	if nil != err {
+		if nil != ctx.Err() {
+			removePartial(partialPath)
+			return nil, errors.Wrapf(ctx.Err(), "Download of [%s] stopped", sourceURL)
+		}
+		cleanPartial(partialPath, sourceURL)
+		return nil, err
+	}
+
+	// Another video may have taken the name during the download
+	var path string
+	if path, err = claimPath(policy, finalPath); nil != err || "" == path {
+		os.Remove(partialPath)
+		removeResumeState(partialPath)
+		if nil == err {
+			logrus.Infof("File [%s] already exists, skip [%s]", finalPath, sourceURL)
+			return &Result{Path: finalPath, Policy: policy, Skipped: true}, nil
+		}
+		return nil, err
+	}
+
+	if err = moveToClaimed(policy, partialPath, path); nil != err {
+		cleanPartial(partialPath, sourceURL)
+		return nil, err
+	}
+	removeResumeState(partialPath)
+	tracker.finish()
+
+	return &Result{Path: path, Policy: policy}, nil
+}
+
+// verifySize - Check the file at path holds expectedSize bytes, when the size is known
+func verifySize(path string, expectedSize int64) error {
+	if expectedSize < 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if nil != err {
+		return errors.Wrapf(err, "Could not get stat on file [%s]", path)
+	}
+	if info.Size() != expectedSize {
+		return fmt.Errorf("Downloaded file [%s] holds [%d] bytes but [%d] were expected", path, info.Size(), expectedSize)
+	}
+	return nil
+}
+
+// cleanPartial - Remove what a failed download left behind, unless it can be resumed later. The
+// directory of the finished stream segments is always kept, the partial file only with its state
+func cleanPartial(partialPath string, videoURL string) {
+	if info, err := os.Stat(partialPath + segmentsSuffix); nil == err && info.IsDir() {
+		logrus.Infof("Keep directory of the finished segments [%s] to resume the download later", partialPath+segmentsSuffix)
+	}
+	if previousState, _ := loadResumeState(partialPath, videoURL); nil != previousState {
+		logrus.Infof("Keep partial file [%s] to resume the download later", partialPath)
+		return
+	}
+	os.Remove(partialPath)
+	removeResumeState(partialPath)
+}
+
+// removePartial - Remove everything a stopped download left behind, resumable or not
+func removePartial(partialPath string) {
+	logrus.Infof("Remove partial file [%s]", partialPath)
+	os.Remove(partialPath)
+	os.RemoveAll(partialPath + segmentsSuffix)
+	removeResumeState(partialPath)
+}
+
+// syncAndClose - Flush the file content to disk before closing it, so a renamed file is complete
+func syncAndClose(file *os.File) error {
+	if err := file.Sync(); nil != err {
+		file.Close()
+		return errors.Wrapf(err, "Error flushing file [%s]", file.Name())
+	}
+	return errors.Wrapf(file.Close(), "Error closing file [%s]", file.Name())
+}
+
+// download - Fetch videoURL into partialPath, with many connections when the server allows it.
+// Returns the size the video must have, -1 when unknown
+func (d *Downloader) download(ctx context.Context, videoURL string, extension string, partialPath string, tracker *progressTracker) (int64, error) {
+	previousState, _ := loadResumeState(partialPath, videoURL)
+	if nil != previousState && previousState.Segmented {
+		// The video must not have changed since the ranges were written
+		if resp := d.probeVideo(ctx, videoURL); nil != resp && acceptRanges(resp) {
+			current := newResumeState(videoURL, resp)
+			if current.Size == previousState.Size && current.validator() == previousState.validator() {
+				missing := previousState.missing()
+				logrus.Infof("Resume segmented download of [%s], [%d] ranges left", videoURL, len(missing))
+				return previousState.Size, d.downloadSegments(ctx, videoURL, partialPath, previousState, missing, tracker)
+			}
+		}
+		logrus.Infof("Server can't resume the segments of [%s], download it from the beginning", videoURL)
+		os.Remove(partialPath)
+		removeResumeState(partialPath)
+		previousState = nil
+	}
+
+	// A resumable partial file is worth more than a fresh segmented download
+	if d.Segments > 1 && nil == previousState {
+		if resp := d.probeVideo(ctx, videoURL); nil != resp {
+			if count := d.segmentCount(resp.ContentLength); acceptRanges(resp) && count > 1 {
+				if err := d.checkContentType(resp, extension); nil != err {
+					return -1, err
+				}
+				state := newResumeState(videoURL, resp)
+				state.Segmented = true
+				logrus.Debugf("Download [%s] of [%d] bytes in [%d] segments", videoURL, state.Size, count)
+				return state.Size, d.downloadSegments(ctx, videoURL, partialPath, state, splitSegments(state.Size, count), tracker)
+			}
+		}
+		logrus.Debugf("Server does not allow a segmented download of [%s], use a single stream", videoURL)
+	}
+
+	// A transfer cut in the middle is resumed by the next attempt when the server allows it
+	var size int64
+	err := d.Retry.DoContext(ctx, fmt.Sprintf("downloading [%s]", videoURL), func() error {
+		var err error
+		size, err = d.downloadStream(ctx, videoURL, extension, partialPath, tracker)
+		return err
+	})
+	return size, err
+}
+
+// downloadStream - Fetch videoURL into partialPath with a single connection, resuming a previous
+// transfer when possible. Returns the size the video must have, -1 when unknown
+func (d *Downloader) downloadStream(ctx context.Context, videoURL string, extension string, partialPath string, tracker *progressTracker) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, videoURL, nil)
+	if nil != err {
+		return -1, errors.Wrapf(err, "Error creating request for [%s]", videoURL)
+	}
+	previousState, offset := loadResumeState(partialPath, videoURL)
+	if nil != previousState {
+		logrus.Debugf("Found [%d] bytes already downloaded in [%s], try to resume", offset, partialPath)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", previousState.validator())
+	}
+
+	resp, err := d.httpClient().Do(req.WithContext(ctx))
+	if nil != err {
+		return -1, errors.Wrapf(err, "Error fetching content [%s]", videoURL)
+	}
+	defer resp.Body.Close()
+
+	// The partial file does not match what the server has anymore, forget it
+	if nil != previousState && http.StatusRequestedRangeNotSatisfiable == resp.StatusCode {
+		logrus.Infof("Server can't resume [%s] from [%d], download it from the beginning", videoURL, offset)
+		resp.Body.Close()
+		os.Remove(partialPath)
+		removeResumeState(partialPath)
+		return d.downloadStream(ctx, videoURL, extension, partialPath, tracker)
+	}
+	if err = retry.CheckStatus(resp); nil != err {
+		return -1, err
+	}
+	if err = d.checkContentType(resp, extension); nil != err {
+		return -1, err
+	}
+
+	// The server may ignore the range or the video may have changed since: start from zero
+	if nil != previousState && !isResumedResponse(resp, offset) {
+		logrus.Infof("Server did not resume [%s], download it from the beginning", videoURL)
+		offset = 0
+	}
+
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0777)
 	if nil != err {
-		return "", errors.Wrapf(err, "Error creating destination file for [%s]", videoURL)
+		return -1, errors.Wrapf(err, "Error creating destination file for [%s]", videoURL)
 	}
 	defer file.Close()
-	var totalWritten int
-	if totalWritten, err = file.Write(content); nil != err || len(content) != totalWritten {
-		return "", errors.Wrapf(err, "Error writing to destination file for [%s]", videoURL)
+	if err = file.Truncate(offset); nil != err {
+		return -1, errors.Wrapf(err, "Error truncating partial file [%s]", partialPath)
+	}
+	if _, err = file.Seek(offset, io.SeekStart); nil != err {
+		return -1, errors.Wrapf(err, "Error seeking partial file [%s]", partialPath)
 	}
 
-	return file.Name(), nil
+	state := newResumeState(videoURL, resp)
+	if "" != state.validator() {
+		if err = state.save(partialPath); nil != err {
+			logrus.Warnf("Download of [%s] won't be resumable, reason: %v", videoURL, err)
+		}
+	} else {
+		removeResumeState(partialPath)
+	}
+
+	tracker.begin(offset, state.Size)
+	if _, err = streamBody(tracker.wrap(file), resp); nil != err {
+		return -1, errors.Wrapf(err, "Error writing to destination file for [%s]", videoURL)
+	}
+	if err = syncAndClose(file); nil != err {
+		return -1, errors.Wrapf(err, "Error closing destination file for [%s]", videoURL)
+	}
+	return state.Size, nil
+}
+
+// isResumedResponse - Check the server answered the range request asked from offset
+func isResumedResponse(resp *http.Response, offset int64) bool {
+	if http.StatusPartialContent != resp.StatusCode {
+		return false
+	}
+	start, _, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+	return nil == err && start == offset
+}
+
+// streamBody - copy the response body into w through a bounded buffer and check the amount
+// of bytes written against the Content-Length announced by the server (when there is one)
+func streamBody(w io.Writer, resp *http.Response) (int64, error) {
+	buffer := make([]byte, copyBufferSize)
+	written, err := io.CopyBuffer(w, resp.Body, buffer)
+	if nil != err {
+		return written, errors.Wrap(err, "Error streaming response body")
+	}
+
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return written, fmt.Errorf("Written [%d] bytes but Content-Length announced [%d]", written, resp.ContentLength)
+	}
+	return written, nil
 }
@@ -1,8 +1,19 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +41,145 @@ func TestGenerateVideoFilename(t *testing.T) {
 	assert.Equal(t, "i_ve_got_friends_yupi.mp4", filename)
 	assert.Nil(t, err)
 }
+
+func TestStreamBody(t *testing.T) {
+	content := "some video bytes"
+
+	// Right case - Content-Length matches
+	var buffer bytes.Buffer
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(content)), ContentLength: int64(len(content))}
+	written, err := streamBody(&buffer, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), written)
+	assert.Equal(t, content, buffer.String())
+
+	// Right case - Content-Length unknown
+	buffer.Reset()
+	resp = &http.Response{Body: ioutil.NopCloser(strings.NewReader(content)), ContentLength: -1}
+	written, err = streamBody(&buffer, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), written)
+
+	// Wrong case - the body is shorter than announced
+	buffer.Reset()
+	resp = &http.Response{Body: ioutil.NopCloser(strings.NewReader(content)), ContentLength: 100}
+	written, err = streamBody(&buffer, resp)
+	assert.Equal(t, int64(len(content)), written)
+	assert.EqualError(t, err, "Written [16] bytes but Content-Length announced [100]")
+}
+
+func TestGetVideoCleanPartial(t *testing.T) {
+	etag := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "" != etag {
+			w.Header().Set("ETag", etag)
+		}
+		// The connection dies before the announced length is sent
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("truncated"))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "cleanpartial")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	// A previous download of the same name must stay untouched
+	finalPath := filepath.Join(destinationPath, "broken.mp4")
+	partialPath := finalPath + partialSuffix
+	assert.Nil(t, ioutil.WriteFile(finalPath, []byte("previous video"), 0666))
+
+	// Wrong case - not resumable, nothing is left behind
+	vi := &VideoInfos{URL: server.URL, Title: "broken", Extension: ".mp4"}
+	result, err := (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+	_, err = os.Stat(partialPath)
+	assert.True(t, os.IsNotExist(err))
+	previous, _ := ioutil.ReadFile(finalPath)
+	assert.Equal(t, "previous video", string(previous))
+
+	// Wrong case - resumable, the partial file is kept for the next run
+	etag = `"v1"`
+	result, err = (&Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+	partial, _ := ioutil.ReadFile(partialPath)
+	assert.Equal(t, "truncated", string(partial))
+	previous, _ = ioutil.ReadFile(finalPath)
+	assert.Equal(t, "previous video", string(previous))
+}
+
+func TestGetVideoCanceled(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("first bytes"))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "canceled")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	// Wrong case - even resumable, nothing is left behind once canceled
+	vi := &VideoInfos{URL: server.URL, Title: "canceled", Extension: ".mp4"}
+	result, err := (&Downloader{}).GetVideo(ctx, vi, destinationPath)
+	assert.Nil(t, result)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, context.Canceled, errors.Cause(err))
+	}
+	files, _ := ioutil.ReadDir(destinationPath)
+	assert.Empty(t, files)
+}
+
+func TestVerifySize(t *testing.T) {
+	file, err := ioutil.TempFile("", "verifysize")
+	if nil != err {
+		t.Fatalf("Could not create temporary file, reason: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("0123456789")
+	file.Close()
+
+	assert.Nil(t, verifySize(file.Name(), 10))
+	assert.Nil(t, verifySize(file.Name(), -1))
+	assert.EqualError(t, verifySize(file.Name(), 11), fmt.Sprintf("Downloaded file [%s] holds [10] bytes but [11] were expected", file.Name()))
+}
+
+func TestVideoInfosJSON(t *testing.T) {
+	vi := &VideoInfos{
+		URL:       "http://u.test/22",
+		Extension: ".mp4",
+		Title:     "movie",
+		ID:        "abc",
+		Duration:  12.5,
+		Formats:   []Format{{ID: "22", URL: "http://u.test/22", Extension: ".mp4", MimeType: "video/mp4", Height: 720}},
+		Audio:     &Track{URL: "http://u.test/audio", Extension: ".m4a", Bandwidth: 128000},
+	}
+	content, err := json.Marshal(vi)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"url": "http://u.test/22",
+		"extension": ".mp4",
+		"title": "movie",
+		"id": "abc",
+		"duration": 12.5,
+		"audio": {"url": "http://u.test/audio", "extension": ".m4a", "bandwidth": 128000},
+		"formats": [{"id": "22", "url": "http://u.test/22", "extension": ".mp4", "mime_type": "video/mp4", "height": 720}]
+	}`, string(content))
+}
@@ -1,21 +1,81 @@
 package downloader_test
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 	"video-downloader/downloader"
+	"video-downloader/retry"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetVideo(t *testing.T) {
 	// Wrong cases
-	videoPath, err := downloader.GetVideo(nil, "")
-	assert.Empty(t, videoPath)
+	result, err := (&downloader.Downloader{}).GetVideo(context.Background(), nil, "")
+	assert.Nil(t, result)
 	assert.EqualError(t, err, "Nil videoInfo passed in argument to 'getVideo'")
 
 	vi := &downloader.VideoInfos{}
-	videoPath, err = downloader.GetVideo(vi, "")
-	assert.Empty(t, videoPath)
+	result, err = (&downloader.Downloader{}).GetVideo(context.Background(), vi, "")
+	assert.Nil(t, result)
 	assert.EqualError(t, err, "Empty video URL on 'getVideo'")
 
+	// Right case - the body is streamed to the destination file
+	content := strings.Repeat("video content ", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "getvideo")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	vi = &downloader.VideoInfos{URL: server.URL, Title: "Streamed video", Extension: ".mp4"}
+	result, err = (&downloader.Downloader{}).GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	written, err := ioutil.ReadFile(result.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(written))
+}
+
+func TestGetVideoRetry(t *testing.T) {
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "retry")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &downloader.Downloader{Retry: &retry.Policy{Attempts: 3, InitialBackoff: time.Millisecond}}
+	vi := &downloader.VideoInfos{URL: server.URL, Title: "retried", Extension: ".mp4"}
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	written, _ := ioutil.ReadFile(result.Path)
+	assert.Equal(t, "video", string(written))
+
+	// Attempts exhausted
+	failures = 3
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, fmt.Sprintf("Giving up downloading [%s] after [3] attempts: Server answered [503 Service Unavailable] for [%s]", server.URL, server.URL))
 }
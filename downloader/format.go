@@ -0,0 +1,294 @@
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFormat is the selector applied when none is configured
+const DefaultFormat = "best"
+
+// Format is one of the streams a site offers for a video, each one at a given quality
+type Format struct {
+	// ID identifies the format on its site, eg the itag
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Extension string `json:"extension"`
+	// Those are optional, extractors fill what the site gives
+	MimeType string `json:"mime_type,omitempty"`
+	Codecs   string `json:"codecs,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	// Bitrate is in bits per second
+	Bitrate int64 `json:"bitrate,omitempty"`
+	// Size is the size of the file in bytes
+	Size int64 `json:"size,omitempty"`
+}
+
+// audioCodecs are the prefixes of the audio codecs a format may declare
+var audioCodecs = []string{"mp4a", "opus", "vorbis", "ac-3", "ec-3", "flac", "mp3"}
+
+// AudioOnly - Check the format holds no video
+func (f *Format) AudioOnly() bool {
+	return strings.HasPrefix(strings.ToLower(f.MimeType), "audio/")
+}
+
+// VideoOnly - Check the format holds no audio, which is only known when it declares its codecs
+func (f *Format) VideoOnly() bool {
+	if f.AudioOnly() || "" == f.Codecs {
+		return false
+	}
+	for _, codec := range strings.Split(strings.ToLower(f.Codecs), ",") {
+		for _, audioCodec := range audioCodecs {
+			if strings.HasPrefix(strings.TrimSpace(codec), audioCodec) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatFilter is a `[field operator value]` condition of a selector
+type formatFilter struct {
+	field    string
+	operator string
+	value    string
+}
+
+// formatSelector picks a format among the ones matching every filter: `best`, `worst` or the one of
+// a given ID
+type formatSelector struct {
+	base    string
+	filters []formatFilter
+}
+
+// formatFilterRegexp matches the first filter of a selector
+var formatFilterRegexp = regexp.MustCompile(`^\[\s*([a-z]+)\s*(<=|>=|!=|\^=|\*=|=|<|>)\s*([^\]]*?)\s*\]`)
+
+// numericFormatFields returns the value of every numeric field a filter can test
+func numericFormatFields(f *Format) map[string]int64 {
+	return map[string]int64{
+		"height":  int64(f.Height),
+		"width":   int64(f.Width),
+		"bitrate": f.Bitrate,
+		"size":    f.Size,
+	}
+}
+
+// textFormatFields returns the value of every text field a filter can test
+func textFormatFields(f *Format) map[string]string {
+	return map[string]string{
+		"id":     f.ID,
+		"ext":    strings.TrimPrefix(f.Extension, "."),
+		"mime":   f.MimeType,
+		"codecs": f.Codecs,
+	}
+}
+
+// SelectFormat - Returns the format picked by expression among formats. The expression is a
+// selector, `best`, `worst` or a format ID, followed by filters such as `[height<=720][ext=mp4]`;
+// alternatives separated by `/` are tried in order, eg `best[height<=720]/worst`. Numeric fields
+// are height, width, bitrate and size, compared with `=`, `!=`, `<`, `<=`, `>` or `>=`; a format
+// which doesn't tell the value never matches. Text fields are id, ext, mime and codecs, compared
+// with `=`, `!=`, `^=` (starts with) or `*=` (contains). `best` and `worst` prefer the formats
+// holding both audio and video, then video only ones, then audio only ones
+func SelectFormat(formats []Format, expression string) (*Format, error) {
+	if "" == strings.TrimSpace(expression) {
+		expression = DefaultFormat
+	}
+	selectors, err := parseFormatSelectors(expression)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(formats) {
+		return nil, errors.New("No format available")
+	}
+
+	for _, selector := range selectors {
+		if selected := selector.pick(formats); nil != selected {
+			return selected, nil
+		}
+	}
+	return nil, fmt.Errorf("No format matches [%s]", expression)
+}
+
+// ValidateFormat - Check expression is a valid format selector, see SelectFormat
+func ValidateFormat(expression string) error {
+	if "" == strings.TrimSpace(expression) {
+		return nil
+	}
+	_, err := parseFormatSelectors(expression)
+	return err
+}
+
+// parseFormatSelectors - Parse the `/` separated alternatives of expression
+func parseFormatSelectors(expression string) ([]formatSelector, error) {
+	var selectors []formatSelector
+	for _, alternative := range strings.Split(expression, "/") {
+		alternative = strings.TrimSpace(alternative)
+		if "" == alternative {
+			return nil, fmt.Errorf("Empty alternative in format [%s]", expression)
+		}
+
+		selector := formatSelector{base: alternative}
+		if bracket := strings.Index(alternative, "["); bracket >= 0 {
+			selector.base = strings.TrimSpace(alternative[:bracket])
+			for rest := alternative[bracket:]; "" != rest; rest = strings.TrimSpace(rest) {
+				match := formatFilterRegexp.FindStringSubmatch(rest)
+				if nil == match {
+					return nil, fmt.Errorf("Invalid filter [%s] in format [%s]", rest, expression)
+				}
+				filter := formatFilter{field: match[1], operator: match[2], value: match[3]}
+				if err := filter.validate(); nil != err {
+					return nil, errors.Wrapf(err, "Invalid filter [%s] in format [%s]", match[0], expression)
+				}
+				selector.filters = append(selector.filters, filter)
+				rest = rest[len(match[0]):]
+			}
+		}
+		if "" == selector.base {
+			selector.base = DefaultFormat
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// validate - Check the field exists and supports the operator
+func (ff *formatFilter) validate() error {
+	if _, numeric := numericFormatFields(&Format{})[ff.field]; numeric {
+		switch ff.operator {
+		case "^=", "*=":
+			return fmt.Errorf("Operator [%s] does not apply to numeric field [%s]", ff.operator, ff.field)
+		}
+		if _, err := strconv.ParseInt(ff.value, 10, 64); nil != err {
+			return fmt.Errorf("Field [%s] needs a number, got [%s]", ff.field, ff.value)
+		}
+		return nil
+	}
+	if _, text := textFormatFields(&Format{})[ff.field]; text {
+		switch ff.operator {
+		case "<", "<=", ">", ">=":
+			return fmt.Errorf("Operator [%s] does not apply to text field [%s]", ff.operator, ff.field)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown field [%s]", ff.field)
+}
+
+// match - Check the format fulfils the filter, which is valid
+func (ff *formatFilter) match(f *Format) bool {
+	if actual, numeric := numericFormatFields(f)[ff.field]; numeric {
+		expected, _ := strconv.ParseInt(ff.value, 10, 64)
+		if 0 == actual {
+			return false
+		}
+		switch ff.operator {
+		case "=":
+			return actual == expected
+		case "!=":
+			return actual != expected
+		case "<":
+			return actual < expected
+		case "<=":
+			return actual <= expected
+		case ">":
+			return actual > expected
+		case ">=":
+			return actual >= expected
+		}
+		return false
+	}
+
+	actual := strings.ToLower(textFormatFields(f)[ff.field])
+	expected := strings.ToLower(strings.TrimPrefix(ff.value, "."))
+	switch ff.operator {
+	case "=":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case "^=":
+		return strings.HasPrefix(actual, expected)
+	case "*=":
+		return strings.Contains(actual, expected)
+	}
+	return false
+}
+
+// pick - Returns the format the selector designates among formats, nil when none matches. `best`
+// and `worst` only rank the formats of the most complete kind, see formatKind
+func (fs *formatSelector) pick(formats []Format) *Format {
+	var candidates []*Format
+	bestKind := 0
+	for i := range formats {
+		if !fs.match(&formats[i]) {
+			continue
+		}
+		candidates = append(candidates, &formats[i])
+		if kind := formatKind(&formats[i]); kind > bestKind {
+			bestKind = kind
+		}
+	}
+
+	var selected *Format
+	base := strings.ToLower(fs.base)
+	for _, candidate := range candidates {
+		if ("best" == base || "worst" == base) && formatKind(candidate) < bestKind {
+			continue
+		}
+		switch base {
+		case "best":
+			if nil == selected || betterFormat(candidate, selected) {
+				selected = candidate
+			}
+		case "worst":
+			if nil == selected || betterFormat(selected, candidate) {
+				selected = candidate
+			}
+		default:
+			if candidate.ID == fs.base {
+				return candidate
+			}
+		}
+	}
+	return selected
+}
+
+// formatKind - Rank what the format holds: 2 for audio and video, 1 for video only, 0 for audio only
+func formatKind(f *Format) int {
+	switch {
+	case f.AudioOnly():
+		return 0
+	case f.VideoOnly():
+		return 1
+	}
+	return 2
+}
+
+// match - Check the format fulfils every filter of the selector
+func (fs *formatSelector) match(f *Format) bool {
+	for i := range fs.filters {
+		if !fs.filters[i].match(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// betterFormat - Check a is of a higher quality than b: resolution first, then bitrate and size
+func betterFormat(a *Format, b *Format) bool {
+	if a.Height != b.Height {
+		return a.Height > b.Height
+	}
+	if a.Width != b.Width {
+		return a.Width > b.Width
+	}
+	if a.Bitrate != b.Bitrate {
+		return a.Bitrate > b.Bitrate
+	}
+	return a.Size > b.Size
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectFormat(t *testing.T) {
+	formats := []Format{
+		{ID: "18", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.42001E, mp4a.40.2", Width: 640, Height: 360, Bitrate: 500000},
+		{ID: "22", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.64001F, mp4a.40.2", Width: 1280, Height: 720, Bitrate: 2000000},
+		{ID: "43", Extension: ".webm", MimeType: "video/webm", Codecs: "vp8.0, vorbis", Width: 640, Height: 360, Bitrate: 600000},
+		{ID: "137", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.640028", Width: 1920, Height: 1080, Bitrate: 4000000, Size: 1000},
+		{ID: "140", Extension: ".m4a", MimeType: "audio/mp4", Codecs: "mp4a.40.2", Bitrate: 128000},
+		{ID: "251", Extension: ".weba", MimeType: "audio/webm", Codecs: "opus", Bitrate: 160000},
+	}
+
+	cases := map[string]string{
+		"":                                 "22",
+		"best":                             "22",
+		"137":                              "137",
+		"best[codecs!=avc1.640028]":        "22",
+		"best[height>720]":                 "137",
+		"worst[height>720]/worst":          "137",
+		"worst":                            "18",
+		"22":                               "22",
+		"140":                              "140",
+		"best[height<=720]":                "22",
+		"[height<=720]":                    "22",
+		"best[height<=720][ext=webm]":      "43",
+		"worst[ext=.mp4]":                  "18",
+		"best[height<360]/worst":           "18",
+		"best[mime^=audio]":                "251",
+		"worst[mime^=audio]":               "140",
+		"best[codecs*=MP4A]":               "22",
+		"best[codecs=mp4a.40.2]":           "140",
+		"best[size>0]":                     "137",
+		"best[id!=22][id!=18][id!=43]":     "137",
+		"best[height!=1080][ext!=webm]":    "22",
+		"best[ bitrate >= 600000 ][id=43]": "43",
+	}
+	for expression, expectedID := range cases {
+		selected, err := SelectFormat(formats, expression)
+		if assert.Nil(t, err, expression) {
+			assert.Equal(t, expectedID, selected.ID, expression)
+		}
+	}
+
+	errorCases := map[string]string{
+		"best[height<100]":     "No format matches [best[height<100]]",
+		"999":                  "No format matches [999]",
+		"best[fps>30]":         "Invalid filter [[fps>30]] in format [best[fps>30]]: Unknown field [fps]",
+		"best[height^=7]":      "Invalid filter [[height^=7]] in format [best[height^=7]]: Operator [^=] does not apply to numeric field [height]",
+		"best[ext<mp4]":        "Invalid filter [[ext<mp4]] in format [best[ext<mp4]]: Operator [<] does not apply to text field [ext]",
+		"best[height<=high]":   "Invalid filter [[height<=high]] in format [best[height<=high]]: Field [height] needs a number, got [high]",
+		"best[height<=720":     "Invalid filter [[height<=720] in format [best[height<=720]",
+		"best[height<=720]foo": "Invalid filter [foo] in format [best[height<=720]foo]",
+		"best//worst":          "Empty alternative in format [best//worst]",
+	}
+	for expression, expectedError := range errorCases {
+		selected, err := SelectFormat(formats, expression)
+		assert.Nil(t, selected, expression)
+		assert.EqualError(t, err, expectedError, expression)
+	}
+
+	selected, err := SelectFormat(nil, "best")
+	assert.Nil(t, selected)
+	assert.EqualError(t, err, "No format available")
+
+	assert.Nil(t, ValidateFormat(""))
+	assert.Nil(t, ValidateFormat("best[height<=720][ext=mp4]/worst"))
+	assert.EqualError(t, ValidateFormat("best[fps>30]"), "Invalid filter [[fps>30]] in format [best[fps>30]]: Unknown field [fps]")
+
+	assert.False(t, formats[0].VideoOnly())
+	assert.False(t, formats[4].VideoOnly())
+	assert.True(t, (&Format{MimeType: "video/webm", Codecs: "vp9"}).VideoOnly())
+	assert.False(t, (&Format{MimeType: "video/mp4", Codecs: "avc1.64001F, mp4a.40.2"}).VideoOnly())
+	assert.True(t, formats[4].AudioOnly())
+}
@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// hlsExtension is the extension of the file the segments of a HLS stream are concatenated in
+const hlsExtension = ".ts"
+
+// maxPlaylistSize bounds the amount of bytes read from a playlist
+const maxPlaylistSize = 10 * 1024 * 1024
+
+// HLSSettings contains the settings used to fetch HLS streams
+type HLSSettings struct {
+	// Concurrency is the number of segments fetched at the same time, 4 by default
+	Concurrency int `mapstructure:"concurrency"`
+	// MaxHeight excludes the variants of a higher resolution, 0 keeps them all
+	MaxHeight int `mapstructure:"max_height"`
+	// MaxBandwidth excludes the variants of a higher bandwidth, in bits per second, 0 keeps them all
+	MaxBandwidth int64 `mapstructure:"max_bandwidth"`
+}
+
+// isHLS - Check the video is a HLS playlist rather than a media file
+func isHLS(vi *VideoInfos) bool {
+	if strings.EqualFold(strings.TrimPrefix(vi.Extension, "."), "m3u8") {
+		return true
+	}
+	parsed, err := url.Parse(vi.URL)
+	return nil == err && strings.EqualFold(path.Ext(parsed.Path), ".m3u8")
+}
+
+// downloadHLS - Fetch the stream of the playlist at playlistURL into partialPath, the best
+// variant of it when it is a master playlist
+func (d *Downloader) downloadHLS(ctx context.Context, playlistURL string, partialPath string, tracker *progressTracker) (int64, error) {
+	playlist, mediaURL, err := d.fetchMediaPlaylist(ctx, playlistURL)
+	if nil != err {
+		return -1, err
+	}
+
+	pieces := playlist.Segments
+	if nil != playlist.Map {
+		pieces = append([]streamSegment{*playlist.Map}, pieces...)
+	}
+	return d.downloadSegmentedStream(ctx, mediaURL, pieces, d.HLS.Concurrency, partialPath, tracker)
+}
+
+// fetchMediaPlaylist - Returns the media playlist at playlistURL, the best variant of it when it
+// is a master playlist, and the URL it was fetched from
+func (d *Downloader) fetchMediaPlaylist(ctx context.Context, playlistURL string) (*hlsPlaylist, string, error) {
+	playlist, base, err := d.fetchPlaylist(ctx, playlistURL)
+	if nil != err {
+		return nil, "", err
+	}
+	mediaURL := base.String()
+	if len(playlist.Variants) > 0 {
+		variant := d.HLS.selectVariant(playlist.Variants)
+		logrus.Debugf("Selected HLS variant [%s] of bandwidth [%d] and resolution [%dx%d]", variant.URI, variant.Bandwidth, variant.Width, variant.Height)
+		if playlist, base, err = d.fetchPlaylist(ctx, variant.URI); nil != err {
+			return nil, "", err
+		}
+		mediaURL = base.String()
+		if len(playlist.Variants) > 0 {
+			return nil, "", fmt.Errorf("Variant [%s] is a master playlist too", variant.URI)
+		}
+	}
+
+	if !playlist.Ended {
+		return nil, "", fmt.Errorf("Live HLS playlist [%s] is not supported", mediaURL)
+	}
+	if 0 == len(playlist.Segments) {
+		return nil, "", fmt.Errorf("HLS playlist [%s] holds no segment", mediaURL)
+	}
+	return playlist, mediaURL, nil
+}
+
+// fetchPlaylist - Fetch and parse the playlist at playlistURL. Returns the URL it was served from,
+// relative URIs are resolved against it
+func (d *Downloader) fetchPlaylist(ctx context.Context, playlistURL string) (*hlsPlaylist, *url.URL, error) {
+	var content []byte
+	var base *url.URL
+	err := d.Retry.DoContext(ctx, fmt.Sprintf("fetching playlist [%s]", playlistURL), func() error {
+		req, err := http.NewRequest(http.MethodGet, playlistURL, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating request for playlist [%s]", playlistURL)
+		}
+		resp, err := d.httpClient().Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error fetching playlist [%s]", playlistURL)
+		}
+		defer resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+		if content, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize)); nil != err {
+			return errors.Wrapf(err, "Error reading playlist [%s]", playlistURL)
+		}
+		base = resp.Request.URL
+		return nil
+	})
+	if nil != err {
+		return nil, nil, err
+	}
+
+	playlist, err := parseM3U8(string(content), base)
+	if nil != err {
+		return nil, nil, errors.Wrapf(err, "Error parsing playlist [%s]", playlistURL)
+	}
+	return playlist, base, nil
+}
+
+// selectVariant - Returns the variant of highest bandwidth within the limits, the lowest one
+// when none fits
+func (hs *HLSSettings) selectVariant(variants []hlsVariant) hlsVariant {
+	var best, lowest *hlsVariant
+	for i := range variants {
+		variant := &variants[i]
+		if nil == lowest || variant.Bandwidth < lowest.Bandwidth {
+			lowest = variant
+		}
+		if (hs.MaxHeight > 0 && variant.Height > hs.MaxHeight) || (hs.MaxBandwidth > 0 && variant.Bandwidth > hs.MaxBandwidth) {
+			continue
+		}
+		if nil == best || variant.Bandwidth > best.Bandwidth || (variant.Bandwidth == best.Bandwidth && variant.Height > best.Height) {
+			best = variant
+		}
+	}
+	if nil == best {
+		logrus.Warnf("No HLS variant within height [%d] and bandwidth [%d], use the lowest one", hs.MaxHeight, hs.MaxBandwidth)
+		return *lowest
+	}
+	return *best
+}
+
+// hlsKeys fetches the encryption keys once and shares them between segments
+type hlsKeys struct {
+	mutex  sync.Mutex
+	keys   map[string][]byte
+	policy *retry.Policy
+	client *http.Client
+}
+
+// get - Returns the AES-128 key at keyURL
+func (hk *hlsKeys) get(ctx context.Context, keyURL string) ([]byte, error) {
+	hk.mutex.Lock()
+	defer hk.mutex.Unlock()
+	if key, exist := hk.keys[keyURL]; exist {
+		return key, nil
+	}
+
+	var key []byte
+	err := hk.policy.DoContext(ctx, fmt.Sprintf("fetching key [%s]", keyURL), func() error {
+		req, err := http.NewRequest(http.MethodGet, keyURL, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating request for key [%s]", keyURL)
+		}
+		resp, err := hk.client.Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error fetching key [%s]", keyURL)
+		}
+		defer resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+		if key, err = ioutil.ReadAll(io.LimitReader(resp.Body, aes.BlockSize+1)); nil != err {
+			return errors.Wrapf(err, "Error reading key [%s]", keyURL)
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	if aes.BlockSize != len(key) {
+		return nil, fmt.Errorf("Key [%s] holds [%d] bytes instead of [%d]", keyURL, len(key), aes.BlockSize)
+	}
+	hk.keys[keyURL] = key
+	return key, nil
+}
+
+// segmentIV - Returns the IV of the key, the media sequence number of s when none is given
+func segmentIV(s streamSegment) []byte {
+	if nil != s.Key.IV {
+		return s.Key.IV
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[aes.BlockSize-8:], uint64(s.Sequence))
+	return iv
+}
+
+// decryptSegment - Decrypt an AES-128-CBC segment and remove its PKCS#7 padding
+func decryptSegment(data []byte, key []byte, iv []byte) ([]byte, error) {
+	if 0 == len(data) || 0 != len(data)%aes.BlockSize {
+		return nil, fmt.Errorf("Encrypted segment size [%d] is not a multiple of [%d]", len(data), aes.BlockSize)
+	}
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding < 1 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("Invalid padding [%d]", padding)
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("Invalid padding [%d]", padding)
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptSegment - AES-128-CBC encrypt data with PKCS#7 padding, as HLS servers do
+func encryptSegment(t *testing.T, data []byte, key []byte, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		t.Fatalf("Could not create cipher, reason: %v", err)
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	return encrypted
+}
+
+func TestDecryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := segmentIV(streamSegment{Sequence: 258, Key: &hlsKey{}})
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2}, iv)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 100} {
+		data := bytes.Repeat([]byte("x"), size)
+		decrypted, err := decryptSegment(encryptSegment(t, data, key, iv), key, iv)
+		assert.Nil(t, err)
+		assert.Equal(t, data, decrypted)
+	}
+
+	_, err := decryptSegment([]byte("short"), key, iv)
+	assert.EqualError(t, err, "Encrypted segment size [5] is not a multiple of [16]")
+	_, err = decryptSegment(encryptSegment(t, []byte("data"), key, iv), []byte("fedcba9876543210"), iv)
+	assert.NotNil(t, err)
+}
+
+func TestGetVideoHLS(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	explicitIV := []byte("fedcba9876543210")
+	segments := []string{"first-", "second-", "third-", "fourth"}
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	failing := map[string]bool{"/s2.ts": true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		fail := failing[r.URL.Path]
+		mutex.Unlock()
+		if fail {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080\nhigh.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360\nlow.m3u8\n")
+		case "/low.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:3\n"+
+				"#EXTINF:2,\ns0.ts\n"+
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n#EXTINF:2,\ns1.ts\n"+
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key\",IV=0x"+fmt.Sprintf("%x", explicitIV)+"\n#EXTINF:2,\ns2.ts\n"+
+				"#EXT-X-KEY:METHOD=NONE\n#EXTINF:2,\n#EXT-X-BYTERANGE:6@2\ns3.ts\n"+
+				"#EXT-X-ENDLIST\n")
+		case "/high.m3u8":
+			t.Errorf("The variant above max_height must not be fetched")
+		case "/key":
+			w.Write(key)
+		case "/s0.ts":
+			fmt.Fprint(w, segments[0])
+		case "/s1.ts":
+			w.Write(encryptSegment(t, []byte(segments[1]), key, segmentIV(streamSegment{Sequence: 4, Key: &hlsKey{}})))
+		case "/s2.ts":
+			w.Write(encryptSegment(t, []byte(segments[2]), key, explicitIV))
+		case "/s3.ts":
+			http.ServeContent(w, r, "s3.ts", time.Time{}, strings.NewReader("xx"+segments[3]+"yy"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "hls")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{HLS: HLSSettings{Concurrency: 1, MaxHeight: 720}}
+	vi := &VideoInfos{URL: server.URL + "/master.m3u8", Title: "stream", Extension: ".m3u8"}
+	finalPath := filepath.Join(destinationPath, "stream.ts")
+	segmentsDir := finalPath + partialSuffix + segmentsSuffix
+
+	// A segment is missing, the finished ones are kept for the next run
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "404 Not Found")
+	assert.False(t, fileExists(finalPath))
+	assert.False(t, fileExists(finalPath+partialSuffix))
+	assert.True(t, fileExists(segmentPath(segmentsDir, 0)))
+	assert.True(t, fileExists(segmentPath(segmentsDir, 1)))
+
+	mutex.Lock()
+	failing = map[string]bool{}
+	mutex.Unlock()
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: finalPath, Policy: CollisionSuffix}, result)
+	content, _ := ioutil.ReadFile(finalPath)
+	assert.Equal(t, strings.Join(segments, ""), string(content))
+	assert.False(t, fileExists(segmentsDir))
+
+	// Segments and the key are fetched once, the failing segment twice
+	assert.Equal(t, 1, requests["/s0.ts"])
+	assert.Equal(t, 1, requests["/s1.ts"])
+	assert.Equal(t, 2, requests["/s2.ts"])
+	assert.Equal(t, 2, requests["/key"])
+}
+
+func TestGetVideoHLSLive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXTINF:2,\ns0.ts\n")
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "hls")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	result, err := (&Downloader{}).GetVideo(context.Background(), &VideoInfos{URL: server.URL + "/live.m3u8", Title: "live"}, destinationPath)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, fmt.Sprintf("Live HLS playlist [%s/live.m3u8] is not supported", server.URL))
+}
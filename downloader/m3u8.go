@@ -0,0 +1,248 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hlsVariant is a stream of a master playlist, each one at a given quality
+type hlsVariant struct {
+	URI       string
+	Bandwidth int64
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+// hlsKey tells how the following segments are encrypted
+type hlsKey struct {
+	// Method is `NONE`, `AES-128` or `SAMPLE-AES`
+	Method string
+	URI    string
+	// IV is the explicit initialisation vector, nil when derived from the media sequence number
+	IV []byte
+}
+
+// hlsPlaylist is either a master playlist, holding Variants, or a media playlist, holding Segments
+type hlsPlaylist struct {
+	Variants []hlsVariant
+	// Map is the initialisation section prepended to the segments (`EXT-X-MAP`), nil when none
+	Map      *streamSegment
+	Segments []streamSegment
+	// Ended is false for live playlists, more segments may be appended later
+	Ended bool
+}
+
+// parseM3U8 - Parse the content of a M3U8 playlist, URIs are resolved against base
+func parseM3U8(content string, base *url.URL) (*hlsPlaylist, error) {
+	playlist := &hlsPlaylist{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var header bool
+	var sequence int64
+	var key *hlsKey
+	var next streamSegment
+	var nextVariant *hlsVariant
+	nextOffset := int64(0)
+	next.Length = -1
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line {
+			continue
+		}
+		if !header {
+			if !strings.HasPrefix(line, "#EXTM3U") {
+				return nil, errors.New("Not a M3U8 playlist, `#EXTM3U` header is missing")
+			}
+			header = true
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			uri, err := resolveReference(base, line)
+			if nil != err {
+				return nil, errors.Wrapf(err, "Invalid URI at line [%d]", lineNumber)
+			}
+			if nil != nextVariant {
+				nextVariant.URI = uri
+				playlist.Variants = append(playlist.Variants, *nextVariant)
+				nextVariant = nil
+				continue
+			}
+			next.URI, next.Sequence, next.Key = uri, sequence, key
+			if next.Length >= 0 && next.Offset < 0 {
+				next.Offset = nextOffset
+			}
+			if next.Length >= 0 {
+				nextOffset = next.Offset + next.Length
+			}
+			playlist.Segments = append(playlist.Segments, next)
+			sequence++
+			next = streamSegment{Length: -1}
+			continue
+		}
+
+		tag, value := line, ""
+		if colon := strings.Index(line, ":"); colon >= 0 {
+			tag, value = line[:colon], line[colon+1:]
+		}
+		var err error
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			attributes := parseAttributeList(value)
+			nextVariant = &hlsVariant{Codecs: attributes["CODECS"]}
+			nextVariant.Bandwidth, _ = strconv.ParseInt(attributes["BANDWIDTH"], 10, 64)
+			if resolution := strings.SplitN(attributes["RESOLUTION"], "x", 2); 2 == len(resolution) {
+				nextVariant.Width, _ = strconv.Atoi(resolution[0])
+				nextVariant.Height, _ = strconv.Atoi(resolution[1])
+			}
+		case "#EXT-X-MEDIA-SEQUENCE":
+			if sequence, err = strconv.ParseInt(value, 10, 64); nil != err {
+				return nil, fmt.Errorf("Invalid media sequence [%s] at line [%d]", value, lineNumber)
+			}
+		case "#EXTINF":
+			duration := strings.SplitN(value, ",", 2)[0]
+			if next.Duration, err = strconv.ParseFloat(duration, 64); nil != err {
+				return nil, fmt.Errorf("Invalid segment duration [%s] at line [%d]", duration, lineNumber)
+			}
+		case "#EXT-X-BYTERANGE":
+			if next.Length, next.Offset, err = parseByteRange(value); nil != err {
+				return nil, errors.Wrapf(err, "Invalid byte range at line [%d]", lineNumber)
+			}
+		case "#EXT-X-KEY":
+			if key, err = parseKey(value, base); nil != err {
+				return nil, errors.Wrapf(err, "Invalid key at line [%d]", lineNumber)
+			}
+		case "#EXT-X-MAP":
+			attributes := parseAttributeList(value)
+			mapSection := &streamSegment{Sequence: sequence, Key: key, Length: -1}
+			if mapSection.URI, err = resolveReference(base, attributes["URI"]); nil != err {
+				return nil, errors.Wrapf(err, "Invalid map URI at line [%d]", lineNumber)
+			}
+			if byteRange, exist := attributes["BYTERANGE"]; exist {
+				if mapSection.Length, mapSection.Offset, err = parseByteRange(byteRange); nil != err {
+					return nil, errors.Wrapf(err, "Invalid map byte range at line [%d]", lineNumber)
+				}
+				if mapSection.Offset < 0 {
+					mapSection.Offset = 0
+				}
+			}
+			if nil != playlist.Map {
+				return nil, fmt.Errorf("Playlist changes its initialisation section at line [%d], which is not supported", lineNumber)
+			}
+			playlist.Map = mapSection
+		case "#EXT-X-ENDLIST":
+			playlist.Ended = true
+		case "#EXT-X-PLAYLIST-TYPE":
+			if "VOD" == strings.ToUpper(value) {
+				playlist.Ended = true
+			}
+		}
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, errors.Wrap(err, "Error reading playlist")
+	}
+	if !header {
+		return nil, errors.New("Not a M3U8 playlist, `#EXTM3U` header is missing")
+	}
+	return playlist, nil
+}
+
+// parseAttributeList - Parse the `KEY=value,KEY="quoted, value"` list of a tag
+func parseAttributeList(value string) map[string]string {
+	attributes := map[string]string{}
+	for "" != value {
+		equal := strings.Index(value, "=")
+		if equal < 0 {
+			break
+		}
+		name := strings.ToUpper(strings.TrimSpace(value[:equal]))
+		value = value[equal+1:]
+
+		var attribute string
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				attribute, value = value[1:], ""
+			} else {
+				attribute, value = value[1:end+1], value[end+2:]
+			}
+			if comma := strings.Index(value, ","); comma >= 0 {
+				value = value[comma+1:]
+			} else {
+				value = ""
+			}
+		} else if comma := strings.Index(value, ","); comma >= 0 {
+			attribute, value = value[:comma], value[comma+1:]
+		} else {
+			attribute, value = value, ""
+		}
+		attributes[name] = strings.TrimSpace(attribute)
+	}
+	return attributes
+}
+
+// parseByteRange - Parse a `length[@offset]` byte range, offset is -1 when it follows the previous one
+func parseByteRange(value string) (int64, int64, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "@", 2)
+	length, err := strconv.ParseInt(parts[0], 10, 64)
+	if nil != err || length < 0 {
+		return 0, 0, fmt.Errorf("Invalid byte range length [%s]", value)
+	}
+	offset := int64(-1)
+	if 2 == len(parts) {
+		if offset, err = strconv.ParseInt(parts[1], 10, 64); nil != err || offset < 0 {
+			return 0, 0, fmt.Errorf("Invalid byte range offset [%s]", value)
+		}
+	}
+	return length, offset, nil
+}
+
+// parseKey - Parse the attributes of a `EXT-X-KEY` tag, nil when segments are not encrypted
+func parseKey(value string, base *url.URL) (*hlsKey, error) {
+	attributes := parseAttributeList(value)
+	key := &hlsKey{Method: strings.ToUpper(attributes["METHOD"])}
+	switch key.Method {
+	case "NONE":
+		return nil, nil
+	case "AES-128":
+	case "":
+		return nil, errors.New("Missing key method")
+	default:
+		return nil, fmt.Errorf("Encryption method [%s] is not supported", key.Method)
+	}
+
+	var err error
+	if key.URI, err = resolveReference(base, attributes["URI"]); nil != err {
+		return nil, errors.Wrap(err, "Invalid key URI")
+	}
+	if iv, exist := attributes["IV"]; exist {
+		iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+		if key.IV, err = hex.DecodeString(iv); nil != err || 16 != len(key.IV) {
+			return nil, fmt.Errorf("Invalid key IV [%s]", attributes["IV"])
+		}
+	}
+	return key, nil
+}
+
+// resolveReference - Returns the absolute URL of reference relatively to base
+func resolveReference(base *url.URL, reference string) (string, error) {
+	if "" == reference {
+		return "", errors.New("Empty URI")
+	}
+	parsed, err := url.Parse(reference)
+	if nil != err {
+		return "", err
+	}
+	if nil == base {
+		return parsed.String(), nil
+	}
+	return base.ResolveReference(parsed).String(), nil
+}
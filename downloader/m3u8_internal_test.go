@@ -0,0 +1,98 @@
+package downloader
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseM3U8Master(t *testing.T) {
+	base, _ := url.Parse("https://cdn.test/videos/master.m3u8?token=1")
+	playlist, err := parseM3U8(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2400000,RESOLUTION=1280x720
+https://other.test/high.m3u8
+`, base)
+	assert.Nil(t, err)
+	assert.Equal(t, []hlsVariant{
+		{URI: "https://cdn.test/videos/low/index.m3u8", Bandwidth: 800000, Width: 640, Height: 360, Codecs: "avc1.4d401e,mp4a.40.2"},
+		{URI: "https://other.test/high.m3u8", Bandwidth: 2400000, Width: 1280, Height: 720},
+	}, playlist.Variants)
+	assert.Empty(t, playlist.Segments)
+}
+
+func TestParseM3U8Media(t *testing.T) {
+	base, _ := url.Parse("https://cdn.test/videos/index.m3u8")
+	playlist, err := parseM3U8(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="100@0"
+#EXTINF:9.5,
+s0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="/keys/k1",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:10,title, with comma
+#EXT-X-BYTERANGE:500@1000
+all.ts
+#EXTINF:10,
+#EXT-X-BYTERANGE:300
+all.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4,
+s3.ts
+#EXT-X-ENDLIST
+`, base)
+	assert.Nil(t, err)
+	key := &hlsKey{Method: "AES-128", URI: "https://cdn.test/keys/k1", IV: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}}
+	assert.Equal(t, &hlsPlaylist{
+		Map: &streamSegment{URI: "https://cdn.test/videos/init.mp4", Sequence: 7, Offset: 0, Length: 100},
+		Segments: []streamSegment{
+			{URI: "https://cdn.test/videos/s0.ts", Duration: 9.5, Sequence: 7, Length: -1},
+			{URI: "https://cdn.test/videos/all.ts", Duration: 10, Sequence: 8, Key: key, Offset: 1000, Length: 500},
+			{URI: "https://cdn.test/videos/all.ts", Duration: 10, Sequence: 9, Key: key, Offset: 1500, Length: 300},
+			{URI: "https://cdn.test/videos/s3.ts", Duration: 4, Sequence: 10, Length: -1},
+		},
+		Ended: true,
+	}, playlist)
+}
+
+func TestParseM3U8Errors(t *testing.T) {
+	cases := map[string]string{
+		"":                                 "Not a M3U8 playlist, `#EXTM3U` header is missing",
+		"<html></html>":                    "Not a M3U8 playlist, `#EXTM3U` header is missing",
+		"#EXTM3U\n#EXTINF:abc,\ns.ts":      "Invalid segment duration [abc] at line [2]",
+		"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:x": "Invalid media sequence [x] at line [2]",
+		"#EXTM3U\n#EXT-X-BYTERANGE:a@1":    "Invalid byte range at line [2]: Invalid byte range length [a@1]",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"":      "Invalid key at line [2]: Encryption method [SAMPLE-AES] is not supported",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x01": "Invalid key at line [2]: Invalid key IV [0x01]",
+	}
+	for content, expected := range cases {
+		playlist, err := parseM3U8(content, nil)
+		assert.Nil(t, playlist, content)
+		assert.EqualError(t, err, expected, content)
+	}
+}
+
+func TestParseAttributeList(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"BANDWIDTH": "1",
+		"CODECS":    "a,b",
+		"URI":       "x=y",
+		"NAME":      "unterminated",
+	}, parseAttributeList(`BANDWIDTH=1,CODECS="a,b",uri="x=y",NAME="unterminated`))
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := []hlsVariant{
+		{URI: "360", Bandwidth: 800, Height: 360},
+		{URI: "1080", Bandwidth: 5000, Height: 1080},
+		{URI: "720", Bandwidth: 2400, Height: 720},
+		{URI: "720-hq", Bandwidth: 2400, Height: 720},
+	}
+	assert.Equal(t, "1080", (&HLSSettings{}).selectVariant(variants).URI)
+	assert.Equal(t, "720", (&HLSSettings{MaxHeight: 720}).selectVariant(variants).URI)
+	assert.Equal(t, "360", (&HLSSettings{MaxBandwidth: 1000}).selectVariant(variants).URI)
+	assert.Equal(t, "360", (&HLSSettings{MaxHeight: 100}).selectVariant(variants).URI)
+}
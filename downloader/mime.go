@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// mediaTypes are the extensions of the files served with each media type, the usual one first.
+// The table is built in, the system ones often list an unusual extension first (`.f4v` for
+// video/mp4) or miss the types entirely on minimal systems
+var mediaTypes = map[string][]string{
+	"video/mp4":                     {".mp4", ".m4v"},
+	"video/x-m4v":                   {".m4v"},
+	"video/webm":                    {".webm"},
+	"video/x-matroska":              {".mkv"},
+	"video/quicktime":               {".mov"},
+	"video/x-msvideo":               {".avi"},
+	"video/x-flv":                   {".flv"},
+	"video/3gpp":                    {".3gp"},
+	"video/mp2t":                    {".ts"},
+	"video/ogg":                     {".ogv"},
+	"video/x-ms-wmv":                {".wmv"},
+	"audio/mp4":                     {".m4a", ".mp4"},
+	"audio/x-m4a":                   {".m4a"},
+	"audio/mpeg":                    {".mp3"},
+	"audio/aac":                     {".aac"},
+	"audio/webm":                    {".weba", ".webm"},
+	"audio/ogg":                     {".ogg", ".opus"},
+	"application/x-mpegurl":         {".m3u8"},
+	"audio/x-mpegurl":               {".m3u8"},
+	"application/vnd.apple.mpegurl": {".m3u8"},
+	"application/dash+xml":          {".mpd"},
+}
+
+// parseMediaType - Returns the lower case media type of typeValue, parameters such as codecs are
+// ignored
+func parseMediaType(typeValue string) string {
+	mediaType, _, err := mime.ParseMediaType(typeValue)
+	if nil != err {
+		// Some sites send `video/mp4; codecs="avc1"; ...` in ways the parser refuses
+		return strings.ToLower(strings.TrimSpace(strings.Split(typeValue, ";")[0]))
+	}
+	return mediaType
+}
+
+// ExtensionFromType - Returns the extension of the files served with the content type typeValue,
+// parameters such as codecs are ignored
+func ExtensionFromType(typeValue string) (string, error) {
+	mediaType := parseMediaType(typeValue)
+	if extensions, exist := mediaTypes[mediaType]; exist {
+		return extensions[0], nil
+	}
+	if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+		// Many extension may be possible, we just use the 1st one
+		return extensions[0], nil
+	}
+	return "", fmt.Errorf("Type information contains no mime-type supported [%s]", typeValue)
+}
+
+// isMediaExtension - Check extension is one of the media types table
+func isMediaExtension(extension string) bool {
+	for _, extensions := range mediaTypes {
+		for _, known := range extensions {
+			if known == extension {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package downloader_test
+
+import (
+	"testing"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtensionFromType(t *testing.T) {
+	cases := map[string]string{
+		"video/mp4":                     ".mp4",
+		"Video/MP4; codecs=\"avc1\"":    ".mp4",
+		"video/webm; codecs=vp9":        ".webm",
+		"video/x-matroska":              ".mkv",
+		"application/vnd.apple.mpegurl": ".m3u8",
+		"image/png":                     ".png",
+	}
+	for typeValue, expected := range cases {
+		extension, err := downloader.ExtensionFromType(typeValue)
+		assert.Nil(t, err, typeValue)
+		assert.Equal(t, expected, extension, typeValue)
+	}
+
+	for _, typeValue := range []string{"", "ouch; wrong", "video/avi; wrong"} {
+		extension, err := downloader.ExtensionFromType(typeValue)
+		assert.Equal(t, "", extension)
+		assert.EqualError(t, err, "Type information contains no mime-type supported ["+typeValue+"]")
+	}
+}
@@ -0,0 +1,494 @@
+package downloader
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxTemplateSegments bounds the segments generated from a template, against absurd durations
+const maxTemplateSegments = 100000
+
+var (
+	templateIdentifierRegexp = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(?:%0(\d+)d)?\$`)
+	isoDurationRegexp        = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// mpd is the part of a DASH manifest used to find the segments of the representations
+type mpd struct {
+	Type                      string      `xml:"type,attr"`
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL                   string      `xml:"BaseURL"`
+	Periods                   []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration string `xml:"duration,attr"`
+	BaseURL  string `xml:"BaseURL"`
+	mpdSegmentInformation
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType    string `xml:"mimeType,attr"`
+	ContentType string `xml:"contentType,attr"`
+	Codecs      string `xml:"codecs,attr"`
+	BaseURL     string `xml:"BaseURL"`
+	mpdSegmentInformation
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID        string `xml:"id,attr"`
+	Bandwidth int64  `xml:"bandwidth,attr"`
+	Width     int    `xml:"width,attr"`
+	Height    int    `xml:"height,attr"`
+	MimeType  string `xml:"mimeType,attr"`
+	Codecs    string `xml:"codecs,attr"`
+	BaseURL   string `xml:"BaseURL"`
+	mpdSegmentInformation
+}
+
+// mpdSegmentInformation tells where the segments are, it may be given at every level of the
+// manifest. The attributes missing at a level are inherited from the upper one
+type mpdSegmentInformation struct {
+	SegmentBase     *mpdSegmentBase     `xml:"SegmentBase"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdSegmentTemplate struct {
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+	StartNumber    *int64 `xml:"startNumber,attr"`
+	Timescale      int64  `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timeline       []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int64  `xml:"r,attr"`
+	} `xml:"SegmentTimeline>S"`
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+type mpdSegmentBase struct {
+	Initialization *mpdURL `xml:"Initialization"`
+}
+
+type mpdSegmentList struct {
+	Initialization *mpdURL `xml:"Initialization"`
+	SegmentURLs    []struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// dashRepresentation is a stream of a DASH manifest, with everything needed to download it
+type dashRepresentation struct {
+	ID        string
+	Bandwidth int64
+	Width     int
+	Height    int
+	MimeType  string
+	Codecs    string
+	// Segments are the pieces to concatenate, the initialisation one first
+	Segments []streamSegment
+}
+
+// isVideo - Check the representation holds a video stream
+func (dr *dashRepresentation) isVideo() bool {
+	return strings.HasPrefix(strings.ToLower(dr.MimeType), "video/")
+}
+
+// isAudio - Check the representation holds an audio stream
+func (dr *dashRepresentation) isAudio() bool {
+	return strings.HasPrefix(strings.ToLower(dr.MimeType), "audio/")
+}
+
+// extension - Returns the extension of the file the segments are concatenated in
+func (dr *dashRepresentation) extension() string {
+	switch dr.MimeType {
+	case "audio/mp4":
+		return ".m4a"
+	case "video/mp4", "":
+		return ".mp4"
+	}
+	if slash := strings.Index(dr.MimeType, "/"); slash >= 0 {
+		return "." + dr.MimeType[slash+1:]
+	}
+	return ".mp4"
+}
+
+// parseMPD - Parse a DASH manifest and returns its representations, URLs are resolved against base.
+// Only the first period of static manifests is supported
+func parseMPD(content []byte, base *url.URL) ([]dashRepresentation, error) {
+	var manifest mpd
+	if err := xml.Unmarshal(content, &manifest); nil != err {
+		return nil, errors.Wrap(err, "Invalid MPD manifest")
+	}
+	if "dynamic" == manifest.Type {
+		return nil, errors.New("Live DASH manifests are not supported")
+	}
+	if 0 == len(manifest.Periods) {
+		return nil, errors.New("MPD manifest holds no period")
+	}
+	period := manifest.Periods[0]
+
+	duration, err := parseISODuration(period.Duration)
+	if nil != err || 0 == duration {
+		if duration, err = parseISODuration(manifest.MediaPresentationDuration); nil != err {
+			return nil, errors.Wrap(err, "Invalid presentation duration")
+		}
+	}
+	if base, err = resolveBase(base, manifest.BaseURL, period.BaseURL); nil != err {
+		return nil, err
+	}
+
+	var representations []dashRepresentation
+	for _, set := range period.AdaptationSets {
+		setBase, err := resolveBase(base, set.BaseURL)
+		if nil != err {
+			return nil, err
+		}
+		for _, r := range set.Representations {
+			representation := dashRepresentation{
+				ID:        r.ID,
+				Bandwidth: r.Bandwidth,
+				Width:     r.Width,
+				Height:    r.Height,
+				MimeType:  firstNotEmpty(r.MimeType, set.MimeType),
+				Codecs:    firstNotEmpty(r.Codecs, set.Codecs),
+			}
+			if "" == representation.MimeType && "" != set.ContentType {
+				representation.MimeType = set.ContentType + "/mp4"
+			}
+			representationBase, err := resolveBase(setBase, r.BaseURL)
+			if nil != err {
+				return nil, err
+			}
+
+			// The innermost level tells how the segments are given, the upper ones may complete it
+			levels := []mpdSegmentInformation{period.mpdSegmentInformation, set.mpdSegmentInformation, r.mpdSegmentInformation}
+			switch innermostSegmentInformation(levels) {
+			case "SegmentTemplate":
+				representation.Segments, err = templateSegments(mergeTemplates(levels), &representation, representationBase, duration)
+			case "SegmentList":
+				representation.Segments, err = listSegments(mergeLists(levels), representationBase)
+			default:
+				representation.Segments, err = baseSegments(mergeBases(levels), representationBase)
+			}
+			if nil != err {
+				return nil, errors.Wrapf(err, "Invalid segments of representation [%s]", r.ID)
+			}
+			representations = append(representations, representation)
+		}
+	}
+	if 0 == len(representations) {
+		return nil, errors.New("MPD manifest holds no representation")
+	}
+	return representations, nil
+}
+
+// templateSegments - Generate the segments of a representation from a SegmentTemplate, either
+// from its timeline or from its fixed duration over the period of duration seconds
+func templateSegments(template *mpdSegmentTemplate, r *dashRepresentation, base *url.URL, duration float64) ([]streamSegment, error) {
+	var segments []streamSegment
+	if "" != template.Initialization {
+		uri, err := resolveReference(base, expandTemplate(template.Initialization, r, 0, 0))
+		if nil != err {
+			return nil, errors.Wrap(err, "Invalid initialization")
+		}
+		segments = append(segments, streamSegment{URI: uri, Length: -1})
+	}
+	if "" == template.Media {
+		return nil, errors.New("Segment template has no media")
+	}
+	number := int64(1)
+	if nil != template.StartNumber {
+		number = *template.StartNumber
+	}
+	timescale := template.Timescale
+	if timescale <= 0 {
+		timescale = 1
+	}
+
+	add := func(time int64) error {
+		if len(segments) > maxTemplateSegments {
+			return fmt.Errorf("More than [%d] segments", maxTemplateSegments)
+		}
+		uri, err := resolveReference(base, expandTemplate(template.Media, r, number, time))
+		if nil != err {
+			return errors.Wrap(err, "Invalid media")
+		}
+		segments = append(segments, streamSegment{URI: uri, Sequence: number, Length: -1})
+		number++
+		return nil
+	}
+
+	if len(template.Timeline) > 0 {
+		var time int64
+		for i, s := range template.Timeline {
+			if nil != s.T {
+				time = *s.T
+			}
+			if s.D <= 0 {
+				return nil, fmt.Errorf("Invalid timeline duration [%d]", s.D)
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next timeline entry or the end of the period
+				end := int64(duration * float64(timescale))
+				if i+1 < len(template.Timeline) && nil != template.Timeline[i+1].T {
+					end = *template.Timeline[i+1].T
+				}
+				repeat = int64(math.Ceil(float64(end-time)/float64(s.D))) - 1
+			}
+			for j := int64(0); j <= repeat; j++ {
+				if err := add(time); nil != err {
+					return nil, err
+				}
+				time += s.D
+			}
+		}
+		return segments, nil
+	}
+
+	if template.Duration <= 0 {
+		return nil, errors.New("Segment template has neither timeline nor duration")
+	}
+	if duration <= 0 {
+		return nil, errors.New("Segment template needs the presentation duration")
+	}
+	count := int64(math.Ceil(duration * float64(timescale) / float64(template.Duration)))
+	for i := int64(0); i < count; i++ {
+		if err := add(i * template.Duration); nil != err {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// listSegments - Returns the segments of a SegmentList
+func listSegments(list *mpdSegmentList, base *url.URL) ([]streamSegment, error) {
+	var segments []streamSegment
+	if nil != list.Initialization {
+		segment, err := rangedSegment(base, list.Initialization.SourceURL, list.Initialization.Range)
+		if nil != err {
+			return nil, errors.Wrap(err, "Invalid initialization")
+		}
+		segments = append(segments, segment)
+	}
+	for i, segmentURL := range list.SegmentURLs {
+		segment, err := rangedSegment(base, segmentURL.Media, segmentURL.MediaRange)
+		if nil != err {
+			return nil, errors.Wrapf(err, "Invalid segment [%d]", i)
+		}
+		segment.Sequence = int64(i + 1)
+		segments = append(segments, segment)
+	}
+	if 0 == len(list.SegmentURLs) {
+		return nil, errors.New("Segment list is empty")
+	}
+	return segments, nil
+}
+
+// baseSegments - Returns the segments of a SegmentBase, or of a representation without segment
+// information. The whole file is downloaded: it holds the initialization, the index and every
+// segment, so the index is not parsed. Only an initialization stored in another file is added
+func baseSegments(segmentBase *mpdSegmentBase, base *url.URL) ([]streamSegment, error) {
+	var segments []streamSegment
+	if nil != segmentBase && nil != segmentBase.Initialization && "" != segmentBase.Initialization.SourceURL {
+		segment, err := rangedSegment(base, segmentBase.Initialization.SourceURL, segmentBase.Initialization.Range)
+		if nil != err {
+			return nil, errors.Wrap(err, "Invalid initialization")
+		}
+		segments = append(segments, segment)
+	}
+	return append(segments, streamSegment{URI: base.String(), Length: -1}), nil
+}
+
+// rangedSegment - Returns the segment at reference, the base itself when empty, limited to the
+// `first-last` byteRange when given
+func rangedSegment(base *url.URL, reference string, byteRange string) (streamSegment, error) {
+	segment := streamSegment{URI: base.String(), Length: -1}
+	if "" != reference {
+		uri, err := resolveReference(base, reference)
+		if nil != err {
+			return segment, err
+		}
+		segment.URI = uri
+	}
+	if "" == byteRange {
+		return segment, nil
+	}
+	bounds := strings.SplitN(byteRange, "-", 2)
+	if 2 != len(bounds) {
+		return segment, fmt.Errorf("Invalid range [%s]", byteRange)
+	}
+	first, errFirst := strconv.ParseInt(bounds[0], 10, 64)
+	last, errLast := strconv.ParseInt(bounds[1], 10, 64)
+	if nil != errFirst || nil != errLast || last < first {
+		return segment, fmt.Errorf("Invalid range [%s]", byteRange)
+	}
+	segment.Offset, segment.Length = first, last-first+1
+	return segment, nil
+}
+
+// expandTemplate - Replace the `$Identifier$` of a SegmentTemplate URL
+func expandTemplate(template string, r *dashRepresentation, number int64, time int64) string {
+	parts := strings.Split(template, "$$")
+	for i, part := range parts {
+		parts[i] = templateIdentifierRegexp.ReplaceAllStringFunc(part, func(identifier string) string {
+			match := templateIdentifierRegexp.FindStringSubmatch(identifier)
+			var value int64
+			switch match[1] {
+			case "RepresentationID":
+				return r.ID
+			case "Number":
+				value = number
+			case "Time":
+				value = time
+			case "Bandwidth":
+				value = r.Bandwidth
+			}
+			if "" != match[2] {
+				return fmt.Sprintf("%0"+match[2]+"d", value)
+			}
+			return strconv.FormatInt(value, 10)
+		})
+	}
+	return strings.Join(parts, "$")
+}
+
+// parseISODuration - Parse a xs:duration such as `PT1H2M3.5S`, in seconds. An empty value is 0
+func parseISODuration(value string) (float64, error) {
+	if "" == value {
+		return 0, nil
+	}
+	match := isoDurationRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if nil == match {
+		return 0, fmt.Errorf("Invalid duration [%s]", value)
+	}
+	var seconds float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if "" != match[i+1] {
+			amount, _ := strconv.ParseFloat(match[i+1], 64)
+			seconds += amount * unit
+		}
+	}
+	return seconds, nil
+}
+
+// resolveBase - Resolve each BaseURL against the previous one, empty ones are skipped
+func resolveBase(base *url.URL, references ...string) (*url.URL, error) {
+	for _, reference := range references {
+		reference = strings.TrimSpace(reference)
+		if "" == reference {
+			continue
+		}
+		parsed, err := url.Parse(reference)
+		if nil != err {
+			return nil, errors.Wrapf(err, "Invalid BaseURL [%s]", reference)
+		}
+		base = base.ResolveReference(parsed)
+	}
+	return base, nil
+}
+
+// innermostSegmentInformation - Returns the kind of segment information of the innermost level
+// declaring one, levels going from the period to the representation
+func innermostSegmentInformation(levels []mpdSegmentInformation) string {
+	for i := len(levels) - 1; i >= 0; i-- {
+		switch {
+		case nil != levels[i].SegmentTemplate:
+			return "SegmentTemplate"
+		case nil != levels[i].SegmentList:
+			return "SegmentList"
+		case nil != levels[i].SegmentBase:
+			return "SegmentBase"
+		}
+	}
+	return ""
+}
+
+// mergeTemplates - Returns the SegmentTemplate of the innermost level, completed by the attributes
+// of the upper ones
+func mergeTemplates(levels []mpdSegmentInformation) *mpdSegmentTemplate {
+	merged := &mpdSegmentTemplate{}
+	for _, level := range levels {
+		template := level.SegmentTemplate
+		if nil == template {
+			continue
+		}
+		merged.Media = firstNotEmpty(template.Media, merged.Media)
+		merged.Initialization = firstNotEmpty(template.Initialization, merged.Initialization)
+		if nil != template.StartNumber {
+			merged.StartNumber = template.StartNumber
+		}
+		if 0 != template.Timescale {
+			merged.Timescale = template.Timescale
+		}
+		if 0 != template.Duration {
+			merged.Duration = template.Duration
+		}
+		if len(template.Timeline) > 0 {
+			merged.Timeline = template.Timeline
+		}
+	}
+	return merged
+}
+
+// mergeLists - Returns the SegmentList of the innermost level, completed by the upper ones
+func mergeLists(levels []mpdSegmentInformation) *mpdSegmentList {
+	merged := &mpdSegmentList{}
+	for _, level := range levels {
+		list := level.SegmentList
+		if nil == list {
+			continue
+		}
+		if nil != list.Initialization {
+			merged.Initialization = list.Initialization
+		}
+		if len(list.SegmentURLs) > 0 {
+			merged.SegmentURLs = list.SegmentURLs
+		}
+	}
+	return merged
+}
+
+// mergeBases - Returns the SegmentBase of the innermost level, completed by the upper ones. It is
+// nil when no level declares one
+func mergeBases(levels []mpdSegmentInformation) *mpdSegmentBase {
+	var merged *mpdSegmentBase
+	for _, level := range levels {
+		if nil == level.SegmentBase {
+			continue
+		}
+		if nil == merged {
+			merged = &mpdSegmentBase{}
+		}
+		if nil != level.SegmentBase.Initialization {
+			merged.Initialization = level.SegmentBase.Initialization
+		}
+	}
+	return merged
+}
+
+func firstNotEmpty(values ...string) string {
+	for _, value := range values {
+		if "" != value {
+			return value
+		}
+	}
+	return ""
+}
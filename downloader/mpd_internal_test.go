@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseISODuration(t *testing.T) {
+	cases := map[string]float64{
+		"":            0,
+		"PT10S":       10,
+		"PT1M30.5S":   90.5,
+		"PT1H":        3600,
+		"P1DT2H":      93600,
+		"PT0H0M4.96S": 4.96,
+	}
+	for value, expected := range cases {
+		seconds, err := parseISODuration(value)
+		assert.Nil(t, err, value)
+		assert.InDelta(t, expected, seconds, 0.0001, value)
+	}
+	_, err := parseISODuration("10 seconds")
+	assert.EqualError(t, err, "Invalid duration [10 seconds]")
+}
+
+func TestExpandTemplate(t *testing.T) {
+	r := &dashRepresentation{ID: "v1", Bandwidth: 800000}
+	assert.Equal(t, "v1/800000/seg-00042-9000.m4s$", expandTemplate("$RepresentationID$/$Bandwidth$/seg-$Number%05d$-$Time$.m4s$$", r, 42, 9000))
+}
+
+func TestParseMPD(t *testing.T) {
+	base, _ := url.Parse("https://cdn.test/movies/manifest.mpd")
+	representations, err := parseMPD([]byte(`<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT9S">
+  <BaseURL>media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number$.m4s" startNumber="0" timescale="1000" duration="4000"/>
+      <Representation id="v360" bandwidth="800000" width="640" height="360" codecs="avc1.4d401e"/>
+      <Representation id="v720" bandwidth="2400000" width="1280" height="720" codecs="avc1.64001f">
+        <SegmentTemplate initialization="hd/init.mp4" media="hd/$Time$.m4s" timescale="10">
+          <SegmentTimeline><S t="0" d="40" r="1"/><S d="10"/></SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" codecs="mp4a.40.2">
+      <Representation id="a1" bandwidth="128000">
+        <BaseURL>https://audio.test/a1.mp4</BaseURL>
+        <SegmentList>
+          <Initialization range="0-99"/>
+          <SegmentURL mediaRange="100-199"/>
+          <SegmentURL media="a1-2.mp4"/>
+        </SegmentList>
+      </Representation>
+      <Representation id="a2" bandwidth="64000" mimeType="audio/webm">
+        <BaseURL>a2.webm</BaseURL>
+        <SegmentBase indexRange="100-200"><Initialization range="0-99"/></SegmentBase>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`), base)
+	assert.Nil(t, err)
+	assert.Equal(t, []dashRepresentation{
+		{ID: "v360", Bandwidth: 800000, Width: 640, Height: 360, MimeType: "video/mp4", Codecs: "avc1.4d401e", Segments: []streamSegment{
+			{URI: "https://cdn.test/movies/media/v360/init.mp4", Length: -1},
+			{URI: "https://cdn.test/movies/media/v360/0.m4s", Sequence: 0, Length: -1},
+			{URI: "https://cdn.test/movies/media/v360/1.m4s", Sequence: 1, Length: -1},
+			{URI: "https://cdn.test/movies/media/v360/2.m4s", Sequence: 2, Length: -1},
+		}},
+		{ID: "v720", Bandwidth: 2400000, Width: 1280, Height: 720, MimeType: "video/mp4", Codecs: "avc1.64001f", Segments: []streamSegment{
+			{URI: "https://cdn.test/movies/media/hd/init.mp4", Length: -1},
+			{URI: "https://cdn.test/movies/media/hd/0.m4s", Sequence: 0, Length: -1},
+			{URI: "https://cdn.test/movies/media/hd/40.m4s", Sequence: 1, Length: -1},
+			{URI: "https://cdn.test/movies/media/hd/80.m4s", Sequence: 2, Length: -1},
+		}},
+		{ID: "a1", Bandwidth: 128000, MimeType: "audio/mp4", Codecs: "mp4a.40.2", Segments: []streamSegment{
+			{URI: "https://audio.test/a1.mp4", Offset: 0, Length: 100},
+			{URI: "https://audio.test/a1.mp4", Sequence: 1, Offset: 100, Length: 100},
+			{URI: "https://audio.test/a1-2.mp4", Sequence: 2, Length: -1},
+		}},
+		{ID: "a2", Bandwidth: 64000, MimeType: "audio/webm", Codecs: "mp4a.40.2", Segments: []streamSegment{
+			{URI: "https://cdn.test/movies/media/a2.webm", Length: -1},
+		}},
+	}, representations)
+	assert.Equal(t, ".mp4", representations[0].extension())
+	assert.Equal(t, ".m4a", representations[2].extension())
+	assert.Equal(t, ".webm", representations[3].extension())
+}
+
+func TestParseMPDInheritance(t *testing.T) {
+	base, _ := url.Parse("https://cdn.test/manifest.mpd")
+	representations, err := parseMPD([]byte(`<MPD mediaPresentationDuration="PT4S"><Period>
+    <SegmentTemplate startNumber="5"/>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate initialization="$RepresentationID$/init.mp4" timescale="1000" duration="2000"/>
+      <Representation id="v1" bandwidth="1000"><SegmentTemplate media="$RepresentationID$/$Number$-$Time$.m4s"/></Representation>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4">
+      <SegmentList><Initialization sourceURL="audio-init.mp4"/></SegmentList>
+      <Representation id="a1" bandwidth="64"><SegmentList><SegmentURL media="a1-1.mp4"/></SegmentList></Representation>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/webm">
+      <SegmentBase><Initialization sourceURL="webm-init.webm" range="0-99"/></SegmentBase>
+      <Representation id="a2" bandwidth="64"><BaseURL>a2.webm</BaseURL><SegmentBase indexRange="100-200"/></Representation>
+      <Representation id="a3" bandwidth="32"><BaseURL>a3.webm</BaseURL></Representation>
+    </AdaptationSet>
+  </Period></MPD>`), base)
+	assert.Nil(t, err)
+	assert.Equal(t, []dashRepresentation{
+		// The attributes missing on the representation template are the ones of the upper levels
+		{ID: "v1", Bandwidth: 1000, MimeType: "video/mp4", Segments: []streamSegment{
+			{URI: "https://cdn.test/v1/init.mp4", Length: -1},
+			{URI: "https://cdn.test/v1/5-0.m4s", Sequence: 5, Length: -1},
+			{URI: "https://cdn.test/v1/6-2000.m4s", Sequence: 6, Length: -1},
+		}},
+		{ID: "a1", Bandwidth: 64, MimeType: "audio/mp4", Segments: []streamSegment{
+			{URI: "https://cdn.test/audio-init.mp4", Length: -1},
+			{URI: "https://cdn.test/a1-1.mp4", Sequence: 1, Length: -1},
+		}},
+		// The whole file holds the index and the segments, only the initialization stored
+		// elsewhere is added
+		{ID: "a2", Bandwidth: 64, MimeType: "audio/webm", Segments: []streamSegment{
+			{URI: "https://cdn.test/webm-init.webm", Offset: 0, Length: 100},
+			{URI: "https://cdn.test/a2.webm", Length: -1},
+		}},
+		{ID: "a3", Bandwidth: 32, MimeType: "audio/webm", Segments: []streamSegment{
+			{URI: "https://cdn.test/webm-init.webm", Offset: 0, Length: 100},
+			{URI: "https://cdn.test/a3.webm", Length: -1},
+		}},
+	}, representations)
+}
+
+func TestParseMPDErrors(t *testing.T) {
+	cases := map[string]string{
+		`not xml`:                             "Invalid MPD manifest: EOF",
+		`<MPD type="dynamic"><Period/></MPD>`: "Live DASH manifests are not supported",
+		`<MPD></MPD>`:                         "MPD manifest holds no period",
+		`<MPD><Period><AdaptationSet/></Period></MPD>`:          "MPD manifest holds no representation",
+		`<MPD mediaPresentationDuration="soon"><Period/></MPD>`: "Invalid presentation duration: Invalid duration [soon]",
+		`<MPD><Period><AdaptationSet><SegmentTemplate media="$Number$" duration="2"/><Representation id="r"/></AdaptationSet></Period></MPD>`:          "Invalid segments of representation [r]: Segment template needs the presentation duration",
+		`<MPD><Period><AdaptationSet><SegmentList><SegmentURL mediaRange="9-1"/></SegmentList><Representation id="r"/></AdaptationSet></Period></MPD>`: "Invalid segments of representation [r]: Invalid segment [0]: Invalid range [9-1]",
+	}
+	base, _ := url.Parse("https://cdn.test/manifest.mpd")
+	for content, expected := range cases {
+		representations, err := parseMPD([]byte(content), base)
+		assert.Nil(t, representations, content)
+		assert.EqualError(t, err, expected, content)
+	}
+}
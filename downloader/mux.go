@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"video-downloader/mp4mux"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// muxExtension is the extension of the file holding the muxed tracks
+const muxExtension = ".mp4"
+
+// muxable - Check the tracks can be muxed into a single MP4 file
+func muxable(tracks []trackFile) bool {
+	if len(tracks) < 2 {
+		return false
+	}
+	for _, track := range tracks {
+		switch strings.ToLower(track.extension) {
+		case ".mp4", ".m4v", ".m4a":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// getMuxedTracks - Download every track next to the video, then mux them into a single MP4 file
+// and remove them. When the tracks can't be muxed, they are kept as separate files and the
+// failure is reported in the result
+func (d *Downloader) getMuxedTracks(ctx context.Context, vi *VideoInfos, destinationPath string, policy CollisionPolicy, tracks []trackFile) (*Result, error) {
+	muxInfos := *vi
+	muxInfos.Extension = muxExtension
+	finalPath, err := d.finalPath(&muxInfos, destinationPath)
+	if nil != err {
+		return nil, err
+	}
+	defer lockPath(finalPath)()
+
+	// Don't download anything when the result is known in advance
+	if CollisionSkip == policy || CollisionFail == policy {
+		path, err := resolveCollision(policy, finalPath)
+		if nil != err {
+			return nil, err
+		}
+		if "" == path {
+			logrus.Infof("File [%s] already exists, skip [%s]", finalPath, vi.URL)
+			return &Result{Path: finalPath, Policy: policy, Skipped: true}, nil
+		}
+	}
+
+	// Track files are intermediate ones, named as partial files so they never replace a file of the
+	// user. A previous run may have left them
+	base := strings.TrimSuffix(finalPath, filepath.Ext(finalPath))
+	var trackPaths []string
+	for _, track := range tracks {
+		trackResult, err := d.getFile(ctx, track.sourceURL, base+"."+track.kind+track.extension+partialSuffix, CollisionOverwrite, track.fetch)
+		if nil != err {
+			if nil != ctx.Err() {
+				removeTracks(trackPaths)
+			}
+			return nil, errors.Wrapf(err, "Error downloading %s track", track.kind)
+		}
+		trackPaths = append(trackPaths, trackResult.Path)
+	}
+
+	partialPath := finalPath + partialSuffix
+	if muxErr := mp4mux.MuxFiles(partialPath, trackPaths...); nil != muxErr {
+		os.Remove(partialPath)
+		logrus.Warnf("Could not mux the tracks of [%s], keep them as separate files: %v", finalPath, muxErr)
+		return keepTracks(policy, trackPaths, muxErr)
+	}
+
+	// Another video may have taken the name during the download
+	path, err := claimPath(policy, finalPath)
+	if nil != err || "" == path {
+		os.Remove(partialPath)
+		removeTracks(trackPaths)
+		if nil == err {
+			logrus.Infof("File [%s] already exists, skip [%s]", finalPath, vi.URL)
+			return &Result{Path: finalPath, Policy: policy, Skipped: true}, nil
+		}
+		return nil, err
+	}
+	if err = moveToClaimed(policy, partialPath, path); nil != err {
+		os.Remove(partialPath)
+		return nil, err
+	}
+	removeTracks(trackPaths)
+	return &Result{Path: path, Policy: policy}, nil
+}
+
+// keepTracks - Give the intermediate track files their final names, according to the collision
+// policy, once they can't be muxed
+func keepTracks(policy CollisionPolicy, trackPaths []string, muxErr error) (*Result, error) {
+	result := &Result{Policy: policy, Skipped: true, MuxError: muxErr}
+	for i, trackPath := range trackPaths {
+		finalPath := strings.TrimSuffix(trackPath, partialSuffix)
+		path, err := claimPath(policy, finalPath)
+		if nil == err && "" != path {
+			err = moveToClaimed(policy, trackPath, path)
+		}
+		if nil != err {
+			removeTracks(trackPaths[i:])
+			return nil, errors.Wrapf(err, "Error keeping tracks which could not be muxed (%v)", muxErr)
+		}
+		if "" == path {
+			logrus.Infof("File [%s] already exists, skip track [%s]", finalPath, trackPath)
+			os.Remove(trackPath)
+			path = finalPath
+		} else {
+			result.Skipped = false
+		}
+		result.Tracks = append(result.Tracks, path)
+	}
+	result.Path = result.Tracks[0]
+	return result, nil
+}
+
+// removeTracks - Remove the track files once muxed
+func removeTracks(trackPaths []string) {
+	for _, trackPath := range trackPaths {
+		if err := os.Remove(trackPath); nil != err {
+			logrus.Warnf("Could not remove track [%s]: %v", trackPath, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// progressReportInterval is the minimum delay between two progress reports of a download
+const progressReportInterval = 200 * time.Millisecond
+
+// Progress describes how far a download went
+type Progress struct {
+	// Filename is the final name of the video being downloaded
+	Filename string
+	// Done is the amount of bytes written, including the ones resumed from a previous run
+	Done int64
+	// Total is the size of the video, -1 when the server did not tell it
+	Total int64
+	// Speed is the average amount of bytes downloaded per second since the start of this run
+	Speed float64
+	// ETA is the estimated time left, -1 when unknown
+	ETA time.Duration
+	// Finished is true on the last report of a successful download
+	Finished bool
+}
+
+// ProgressFunc receives the progress of downloads. It is called from the downloading goroutines,
+// so it must be fast and safe to use concurrently
+type ProgressFunc func(Progress)
+
+// progressTracker counts the bytes written by one download and reports them to a ProgressFunc.
+// A nil tracker does nothing, so downloads without callback don't pay for it
+type progressTracker struct {
+	mutex      sync.Mutex
+	report     ProgressFunc
+	filename   string
+	total      int64
+	done       int64
+	resumed    int64
+	start      time.Time
+	lastReport time.Time
+}
+
+// newProgressTracker - Returns nil when there is nobody to report to
+func newProgressTracker(report ProgressFunc, filename string) *progressTracker {
+	if nil == report {
+		return nil
+	}
+	return &progressTracker{report: report, filename: filename, total: -1}
+}
+
+// begin - (Re)start tracking a transfer of total bytes where done are already on disk
+func (pt *progressTracker) begin(done int64, total int64) {
+	if nil == pt {
+		return
+	}
+	pt.mutex.Lock()
+	pt.done, pt.resumed, pt.total = done, done, total
+	pt.start = time.Now()
+	pt.lastReport = time.Time{}
+	pt.mutex.Unlock()
+}
+
+// add - Count n more bytes written, report them when the last report is old enough
+func (pt *progressTracker) add(n int64) {
+	if nil == pt {
+		return
+	}
+	pt.mutex.Lock()
+	pt.done += n
+	now := time.Now()
+	if now.Sub(pt.lastReport) < progressReportInterval {
+		pt.mutex.Unlock()
+		return
+	}
+	pt.lastReport = now
+	progress := pt.snapshot(now)
+	pt.mutex.Unlock()
+
+	pt.report(progress)
+}
+
+// finish - Send the last report of a successful download
+func (pt *progressTracker) finish() {
+	if nil == pt {
+		return
+	}
+	pt.mutex.Lock()
+	progress := pt.snapshot(time.Now())
+	pt.mutex.Unlock()
+
+	progress.Finished = true
+	progress.ETA = 0
+	if progress.Total < 0 {
+		progress.Total = progress.Done
+	}
+	pt.report(progress)
+}
+
+// snapshot - Compute the progress at now, the mutex must be held
+func (pt *progressTracker) snapshot(now time.Time) Progress {
+	progress := Progress{Filename: pt.filename, Done: pt.done, Total: pt.total, ETA: -1}
+	if elapsed := now.Sub(pt.start).Seconds(); elapsed > 0 {
+		progress.Speed = float64(pt.done-pt.resumed) / elapsed
+	}
+	if pt.total >= 0 && progress.Speed > 0 {
+		progress.ETA = time.Duration(float64(pt.total-pt.done) / progress.Speed * float64(time.Second))
+	}
+	return progress
+}
+
+// wrap - Returns a writer counting in the tracker what is written to w
+func (pt *progressTracker) wrap(w io.Writer) io.Writer {
+	if nil == pt {
+		return w
+	}
+	return &progressWriter{w: w, tracker: pt}
+}
+
+// progressWriter forwards writes to w and counts them in tracker
+type progressWriter struct {
+	w       io.Writer
+	tracker *progressTracker
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.tracker.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	// A nil tracker does nothing
+	var nilTracker *progressTracker
+	nilTracker.begin(0, 10)
+	nilTracker.add(10)
+	nilTracker.finish()
+	var buffer bytes.Buffer
+	assert.Equal(t, &buffer, nilTracker.wrap(&buffer))
+	assert.Nil(t, newProgressTracker(nil, "video.mp4"))
+
+	var reports []Progress
+	tracker := newProgressTracker(func(p Progress) { reports = append(reports, p) }, "video.mp4")
+	tracker.begin(50, 200)
+	tracker.wrap(&buffer).Write(make([]byte, 50))
+	// Reports are throttled
+	tracker.add(50)
+	tracker.finish()
+
+	assert.Len(t, reports, 2)
+	assert.Equal(t, int64(100), reports[0].Done)
+	assert.Equal(t, int64(200), reports[0].Total)
+	assert.Equal(t, "video.mp4", reports[0].Filename)
+	assert.False(t, reports[0].Finished)
+	assert.True(t, reports[0].Speed > 0)
+	assert.True(t, reports[0].ETA >= 0)
+	assert.Equal(t, Progress{Filename: "video.mp4", Done: 150, Total: 200, Speed: reports[1].Speed, Finished: true}, reports[1])
+
+	// Unknown size
+	tracker.begin(0, -1)
+	tracker.lastReport = time.Time{}
+	tracker.add(10)
+	assert.Equal(t, time.Duration(-1), reports[2].ETA)
+}
+
+func TestGetVideoProgress(t *testing.T) {
+	content := strings.Repeat("x", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "progress")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	var mutex sync.Mutex
+	var last Progress
+	d := &Downloader{Progress: func(p Progress) {
+		mutex.Lock()
+		last = p
+		mutex.Unlock()
+	}}
+	result, err := d.GetVideo(context.Background(), &VideoInfos{URL: server.URL, Title: "progress", Extension: ".mp4"}, destinationPath)
+	assert.Nil(t, err)
+	assert.True(t, last.Finished)
+	assert.Equal(t, result.Path, last.Filename)
+	assert.Equal(t, int64(len(content)), last.Done)
+	assert.Equal(t, int64(len(content)), last.Total)
+}
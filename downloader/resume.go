@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// partialSuffix is appended to the final filename while the video is being downloaded
+	partialSuffix = ".part"
+	// stateSuffix is appended to the partial filename to store what is needed to resume it
+	stateSuffix = ".json"
+)
+
+// resumeState is the sidecar written next to a partial file. It keeps what is needed to ask
+// the server for the rest of the video on a next run
+type resumeState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+	// Segmented tells the partial file is allocated at its full size and written by ranges,
+	// Completed are the ranges written already
+	Segmented bool      `json:"segmented,omitempty"`
+	Completed []segment `json:"completed,omitempty"`
+}
+
+// validator - Returns the value to send in `If-Range`. Weak ETags can't be used for range requests
+func (rs *resumeState) validator() string {
+	if "" != rs.ETag && !strings.HasPrefix(rs.ETag, "W/") {
+		return rs.ETag
+	}
+	return rs.LastModified
+}
+
+// newResumeState - Build the state from the response of the server for the given url
+func newResumeState(videoURL string, resp *http.Response) *resumeState {
+	rs := &resumeState{
+		URL:          videoURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         -1,
+	}
+	if http.StatusPartialContent == resp.StatusCode {
+		if _, _, total, err := parseContentRange(resp.Header.Get("Content-Range")); nil == err {
+			rs.Size = total
+		}
+	} else {
+		rs.Size = resp.ContentLength
+	}
+	return rs
+}
+
+// loadResumeState - Read the state of a previous run for partialPath. Returns nil when there is
+// nothing to resume: no partial file, no state, or a state written for another url
+func loadResumeState(partialPath string, videoURL string) (*resumeState, int64) {
+	partialInfo, err := os.Stat(partialPath)
+	if nil != err || 0 == partialInfo.Size() {
+		return nil, 0
+	}
+
+	content, err := ioutil.ReadFile(partialPath + stateSuffix)
+	if nil != err {
+		return nil, 0
+	}
+	rs := &resumeState{}
+	if err = json.Unmarshal(content, rs); nil != err || rs.URL != videoURL || "" == rs.validator() {
+		return nil, 0
+	}
+	return rs, partialInfo.Size()
+}
+
+// missing - Returns the ranges of a segmented download not completed yet
+func (rs *resumeState) missing() []segment {
+	completed := append([]segment{}, rs.Completed...)
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].Start < completed[j].Start
+	})
+	var missing []segment
+	var next int64
+	for _, s := range completed {
+		if s.Start > next {
+			missing = append(missing, segment{Start: next, End: s.Start - 1})
+		}
+		if s.End+1 > next {
+			next = s.End + 1
+		}
+	}
+	if next < rs.Size {
+		missing = append(missing, segment{Start: next, End: rs.Size - 1})
+	}
+	return missing
+}
+
+// save - Write the state next to the partial file
+func (rs *resumeState) save(partialPath string) error {
+	content, err := json.Marshal(rs)
+	if nil != err {
+		return errors.Wrap(err, "Error encoding resume state")
+	}
+	if err = ioutil.WriteFile(partialPath+stateSuffix, content, 0666); nil != err {
+		return errors.Wrapf(err, "Error writing resume state for [%s]", partialPath)
+	}
+	return nil
+}
+
+// removeResumeState - Remove the sidecar of partialPath, if any
+func removeResumeState(partialPath string) {
+	os.Remove(partialPath + stateSuffix)
+}
+
+// parseContentRange - Parse a `Content-Range: bytes start-end/total` header value.
+// total is -1 when the server sent `*`
+func parseContentRange(value string) (start int64, end int64, total int64, err error) {
+	var totalValue string
+	if _, err = fmt.Sscanf(value, "bytes %d-%d/%s", &start, &end, &totalValue); nil != err {
+		return 0, 0, 0, errors.Wrapf(err, "Error parsing Content-Range [%s]", value)
+	}
+	total = -1
+	if "*" != totalValue {
+		if _, err = fmt.Sscanf(totalValue, "%d", &total); nil != err {
+			return 0, 0, 0, errors.Wrapf(err, "Error parsing Content-Range total [%s]", value)
+		}
+	}
+	return start, end, total, nil
+}
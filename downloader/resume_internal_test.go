@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContentRange(t *testing.T) {
+	start, end, total, err := parseContentRange("bytes 10-99/100")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{10, 99, 100}, []int64{start, end, total})
+
+	start, end, total, err = parseContentRange("bytes 0-9/*")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 9, -1}, []int64{start, end, total})
+
+	_, _, _, err = parseContentRange("items 0-9/10")
+	assert.NotNil(t, err)
+}
+
+func TestGetVideoResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	etag := `"v1"`
+	var rangesAsked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangesAsked = append(rangesAsked, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "resume")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{OnCollision: CollisionOverwrite}
+	vi := &VideoInfos{URL: server.URL, Title: "resumed", Extension: ".mp4"}
+	finalPath := filepath.Join(destinationPath, "resumed.mp4")
+	partialPath := finalPath + partialSuffix
+
+	// Right case - half of the video was downloaded by a previous run
+	writePartial := func(validator string) {
+		assert.Nil(t, ioutil.WriteFile(partialPath, content[:4000], 0666))
+		assert.Nil(t, (&resumeState{URL: server.URL, ETag: validator, Size: int64(len(content))}).save(partialPath))
+	}
+	writePartial(etag)
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{Path: finalPath, Policy: CollisionOverwrite}, result)
+	assert.Equal(t, []string{"bytes=4000-"}, rangesAsked)
+	written, _ := ioutil.ReadFile(finalPath)
+	assert.Equal(t, content, written)
+	_, err = os.Stat(partialPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(partialPath + stateSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// Right case - the video changed on the server, it is downloaded from the beginning
+	rangesAsked = nil
+	writePartial(`"v0"`)
+	_, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bytes=4000-"}, rangesAsked)
+	written, _ = ioutil.ReadFile(finalPath)
+	assert.Equal(t, content, written)
+
+	// Right case - state written for another url is ignored
+	rangesAsked = nil
+	writePartial(etag)
+	vi.URL = server.URL + "/other"
+	_, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{""}, rangesAsked)
+	written, _ = ioutil.ReadFile(finalPath)
+	assert.Equal(t, content, written)
+}
@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxFilenameBytes is the longest filename most filesystems accept (ext4, NTFS, APFS...)
+const maxFilenameBytes = 255
+
+// maxExtensionBytes bounds what is considered an extension when a filename gets truncated
+const maxExtensionBytes = 16
+
+// reservedNames can't be used as a filename on Windows, whatever the extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeFilename - Make name usable as a filename on common filesystems. Unicode letters are kept
+// and normalised to NFC; only characters illegal on Windows, Linux or macOS are dropped, path
+// separators become `_`. Returns an empty string when nothing usable is left
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case '/' == r || '\\' == r:
+			return '_'
+		case r < ' ' || 0x7f == r || utf8.RuneError == r:
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return -1
+		}
+		return r
+	}, norm.NFC.String(name))
+
+	// Windows silently drops trailing dots and spaces
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if "" == name || ".." == name {
+		return ""
+	}
+
+	base := name
+	if dot := strings.Index(base, "."); dot >= 0 {
+		base = base[:dot]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = base + "_" + name[len(base):]
+	}
+	return name
+}
+
+// truncateFilename - Cut name to maxBytes bytes at most, keeping its extension and never
+// splitting a rune
+func truncateFilename(name string, maxBytes int) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+
+	extension := filepath.Ext(name)
+	if len(extension) > maxExtensionBytes || len(extension) >= maxBytes {
+		extension = ""
+	}
+	base := name[:len(name)-len(extension)]
+	limit := maxBytes - len(extension)
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+	return strings.TrimRight(base[:limit], ". ") + extension
+}
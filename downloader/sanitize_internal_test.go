@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"I ve got friends yupi":      "I ve got friends yupi",
+		"日本語のタイトル":                   "日本語のタイトル",
+		"Привет, мир!":               "Привет, мир!",
+		"Cafe\u0301":                 "Caf\u00e9",
+		"What? Why: <the> \"story\"": "What Why the story",
+		"AC/DC \\ live":              "AC_DC _ live",
+		"tab\there\x00":              "tabhere",
+		"trailing dots...  ":         "trailing dots",
+		"CON":                        "CON_",
+		"lpt1.mp4":                   "lpt1_.mp4",
+		"CONSOLE":                    "CONSOLE",
+		"???":                        "",
+		"..":                         "",
+	}
+
+	for name, expected := range cases {
+		assert.Equal(t, expected, sanitizeFilename(name), name)
+	}
+}
+
+func TestTruncateFilename(t *testing.T) {
+	assert.Equal(t, "short.mp4", truncateFilename("short.mp4", 255))
+
+	// 2 bytes runes can't be split in half
+	long := strings.Repeat("é", 200) + ".mp4"
+	truncated := truncateFilename(long, 255)
+	assert.True(t, len(truncated) <= 255)
+	assert.True(t, utf8.ValidString(truncated))
+	assert.True(t, strings.HasSuffix(truncated, ".mp4"))
+	assert.Equal(t, strings.Repeat("é", 125)+".mp4", truncated)
+
+	// No extension
+	assert.Equal(t, "ab", truncateFilename("abcdef", 2))
+}
+
+func TestGenerateVideoFilenameUnicode(t *testing.T) {
+	filename, err := generateVideoFilename(&VideoInfos{Title: "Привет мир", Extension: ".mp4"})
+	assert.Nil(t, err)
+	assert.Equal(t, "привет_мир.mp4", filename)
+
+	filename, err = generateVideoFilename(&VideoInfos{Title: "日本語: テスト?", Extension: "webm"})
+	assert.Nil(t, err)
+	assert.Equal(t, "日本語_テスト.webm", filename)
+
+	// Nothing left from the title, the ID is used
+	filename, err = generateVideoFilename(&VideoInfos{Title: "???", ID: "abc123", Extension: ".mp4"})
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123.mp4", filename)
+
+	filename, err = generateVideoFilename(&VideoInfos{Title: "???", Extension: ".mp4"})
+	assert.Empty(t, filename)
+	assert.EqualError(t, err, "No enough information to create video filename")
+
+	filename, err = generateVideoFilename(&VideoInfos{Title: strings.Repeat("видео ", 100), Extension: ".mp4"})
+	assert.Nil(t, err)
+	assert.True(t, len(filename) <= maxFilenameBytes)
+	assert.True(t, utf8.ValidString(filename))
+	assert.True(t, strings.HasSuffix(filename, ".mp4"))
+}
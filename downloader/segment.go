@@ -0,0 +1,206 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMinSegmentSize is used when the configuration does not set `min_segment_size`
+const defaultMinSegmentSize = 1024 * 1024
+
+// segment is a byte range [Start, End] of the video, both included as in the `Range` header
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// offsetWriter writes sequentially into a file from a given offset. Many of them can share the
+// same file as long as they write on distinct ranges
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.file.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
+
+// segmentCount - Returns how many segments a video of size bytes is split in. Every segment
+// holds at least MinSegmentSize bytes
+func (d *Downloader) segmentCount(size int64) int {
+	if size <= 0 || d.Segments <= 1 {
+		return 1
+	}
+	minSegmentSize := d.MinSegmentSize
+	if minSegmentSize <= 0 {
+		minSegmentSize = defaultMinSegmentSize
+	}
+
+	count := int64(d.Segments)
+	if maxCount := size / minSegmentSize; maxCount < count {
+		count = maxCount
+	}
+	if count < 1 {
+		return 1
+	}
+	return int(count)
+}
+
+// splitSegments - Cut size bytes in count contiguous segments, the last one takes the remainder
+func splitSegments(size int64, count int) []segment {
+	segments := make([]segment, 0, count)
+	segmentSize := size / int64(count)
+	for i := 0; i < count; i++ {
+		start := int64(i) * segmentSize
+		end := start + segmentSize - 1
+		if i == count-1 {
+			end = size - 1
+		}
+		segments = append(segments, segment{Start: start, End: end})
+	}
+	return segments
+}
+
+// probeVideo - Ask the server the headers of the video, nil when it could not answer them
+func (d *Downloader) probeVideo(ctx context.Context, videoURL string) *http.Response {
+	var resp *http.Response
+	err := d.Retry.DoContext(ctx, fmt.Sprintf("probing [%s]", videoURL), func() error {
+		req, err := http.NewRequest(http.MethodHead, videoURL, nil)
+		if nil != err {
+			return err
+		}
+		if resp, err = d.httpClient().Do(req.WithContext(ctx)); nil != err {
+			return err
+		}
+		resp.Body.Close()
+		return retry.CheckStatus(resp)
+	})
+	if nil != err || http.StatusOK != resp.StatusCode {
+		return nil
+	}
+	return resp
+}
+
+// acceptRanges - Check the server told it accepts range requests
+func acceptRanges(resp *http.Response) bool {
+	return strings.Contains(strings.ToLower(resp.Header.Get("Accept-Ranges")), "bytes")
+}
+
+// downloadSegments - Fetch the ranges of videoURL on separate connections, each one written in
+// place in partialPath. The ranges finished are added to state and saved next to partialPath, so
+// an interrupted download only fetches the missing ones
+func (d *Downloader) downloadSegments(ctx context.Context, videoURL string, partialPath string, state *resumeState, ranges []segment, tracker *progressTracker) error {
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0777)
+	if nil != err {
+		return errors.Wrapf(err, "Error creating destination file for [%s]", videoURL)
+	}
+	defer file.Close()
+	if err = file.Truncate(state.Size); nil != err {
+		return errors.Wrapf(err, "Error allocating [%d] bytes for [%s]", state.Size, partialPath)
+	}
+	resumable := "" != state.validator()
+	if resumable {
+		if err = state.save(partialPath); nil != err {
+			logrus.Warnf("Download of [%s] won't be resumable, reason: %v", videoURL, err)
+			resumable = false
+		}
+	} else {
+		removeResumeState(partialPath)
+	}
+
+	// The first segment failing stops all the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := state.Size
+	for _, s := range ranges {
+		done -= s.End - s.Start + 1
+	}
+	tracker.begin(done, state.Size)
+	var wg sync.WaitGroup
+	var stateMutex sync.Mutex
+	errs := make(chan error, len(ranges))
+	for _, s := range ranges {
+		wg.Add(1)
+		go func(s segment) {
+			defer wg.Done()
+			description := fmt.Sprintf("downloading segment [%d-%d] of [%s]", s.Start, s.End, videoURL)
+			err := d.Retry.DoContext(ctx, description, func() error {
+				return d.downloadSegment(ctx, videoURL, state.validator(), s, file, tracker)
+			})
+			if nil != err {
+				errs <- err
+				cancel()
+				return
+			}
+			if !resumable {
+				return
+			}
+			// The range is only recorded once on disk
+			stateMutex.Lock()
+			defer stateMutex.Unlock()
+			if err = file.Sync(); nil == err {
+				state.Completed = append(state.Completed, s)
+				err = state.save(partialPath)
+			}
+			if nil != err {
+				logrus.Warnf("Could not record segment [%d-%d] of [%s] as done, reason: %v", s.Start, s.End, videoURL, err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err = <-errs; nil != err {
+		return errors.Wrapf(err, "Error writing to destination file for [%s]", videoURL)
+	}
+	if err = syncAndClose(file); nil != err {
+		return errors.Wrapf(err, "Error closing destination file for [%s]", videoURL)
+	}
+	return nil
+}
+
+// downloadSegment - Fetch the range s of videoURL and write it at its place in file
+func (d *Downloader) downloadSegment(ctx context.Context, videoURL string, validator string, s segment, file *os.File, tracker *progressTracker) error {
+	req, err := http.NewRequest(http.MethodGet, videoURL, nil)
+	if nil != err {
+		return errors.Wrapf(err, "Error creating request for [%s]", videoURL)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", s.Start, s.End))
+	if "" != validator {
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := d.httpClient().Do(req)
+	if nil != err {
+		return errors.Wrapf(err, "Error fetching segment [%d-%d]", s.Start, s.End)
+	}
+	defer resp.Body.Close()
+	if err = retry.CheckStatus(resp); nil != err {
+		return err
+	}
+
+	// A full answer means the server changed its mind about ranges or the video changed meanwhile
+	if !isResumedResponse(resp, s.Start) || resp.ContentLength != s.End-s.Start+1 {
+		return fmt.Errorf("Server did not answer range [%d-%d], got status [%s]", s.Start, s.End, resp.Status)
+	}
+
+	written, err := streamBody(tracker.wrap(&offsetWriter{file: file, offset: s.Start}), resp)
+	if nil != err {
+		// The whole segment is written again by the next attempt
+		tracker.add(-written)
+		return errors.Wrapf(err, "Error fetching segment [%d-%d]", s.Start, s.End)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentCount(t *testing.T) {
+	d := &Downloader{Segments: 4, MinSegmentSize: 100}
+	assert.Equal(t, 4, d.segmentCount(1000))
+	assert.Equal(t, 2, d.segmentCount(250))
+	assert.Equal(t, 1, d.segmentCount(99))
+	assert.Equal(t, 1, d.segmentCount(-1))
+
+	d = &Downloader{}
+	assert.Equal(t, 1, d.segmentCount(1000))
+}
+
+func TestSplitSegments(t *testing.T) {
+	assert.Equal(t, []segment{{0, 332}, {333, 665}, {666, 1000}}, splitSegments(1001, 3))
+	assert.Equal(t, []segment{{0, 9}}, splitSegments(10, 1))
+}
+
+func TestGetVideoSegmented(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghij", 1000))
+	var mutex sync.Mutex
+	var rangesAsked []string
+	acceptRanges := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet == r.Method {
+			mutex.Lock()
+			rangesAsked = append(rangesAsked, r.Header.Get("Range"))
+			mutex.Unlock()
+		}
+		if !acceptRanges {
+			w.Write(content)
+			return
+		}
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "segmented")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{Segments: 4, MinSegmentSize: 1000, OnCollision: CollisionOverwrite}
+	vi := &VideoInfos{URL: server.URL, Title: "segmented", Extension: ".mp4"}
+
+	// Right case - the video is fetched in 4 ranges
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(destinationPath, "segmented.mp4"), result.Path)
+	assert.ElementsMatch(t, []string{"bytes=0-2499", "bytes=2500-4999", "bytes=5000-7499", "bytes=7500-9999"}, rangesAsked)
+	written, _ := ioutil.ReadFile(result.Path)
+	assert.Equal(t, content, written)
+
+	// Right case - no Accept-Ranges, a single stream is used
+	rangesAsked = nil
+	acceptRanges = false
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{""}, rangesAsked)
+	written, _ = ioutil.ReadFile(result.Path)
+	assert.Equal(t, content, written)
+}
+
+func TestGetVideoSegmentedResume(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghij", 1000))
+	var mutex sync.Mutex
+	var rangesAsked []string
+	etag := `"v1"`
+	failing := "bytes=5000-7499"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet == r.Method {
+			mutex.Lock()
+			rangesAsked = append(rangesAsked, r.Header.Get("Range"))
+			mutex.Unlock()
+			if failing == r.Header.Get("Range") {
+				// The other ranges are finished before this one fails and stops them
+				time.Sleep(100 * time.Millisecond)
+				http.Error(w, "unavailable", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "segmented")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{Segments: 4, MinSegmentSize: 1000}
+	vi := &VideoInfos{URL: server.URL, Title: "segmented", Extension: ".mp4"}
+	partialPath := filepath.Join(destinationPath, "segmented.mp4"+partialSuffix)
+
+	// Wrong case - a range fails, the finished ones are recorded next to the partial file
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+	state, _ := loadResumeState(partialPath, server.URL)
+	if assert.NotNil(t, state) {
+		assert.True(t, state.Segmented)
+		assert.Equal(t, []segment{{5000, 7499}}, state.missing())
+	}
+
+	// Right case - only the missing range is fetched
+	rangesAsked = nil
+	failing = ""
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bytes=5000-7499"}, rangesAsked)
+	written, _ := ioutil.ReadFile(result.Path)
+	assert.Equal(t, content, written)
+	assert.False(t, fileExists(partialPath+stateSuffix))
+
+	// Right case - the video changed since the ranges were written, it is fetched again
+	failing = "bytes=5000-7499"
+	d.OnCollision = CollisionOverwrite
+	_, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.NotNil(t, err)
+	rangesAsked = nil
+	failing = ""
+	etag = `"v2"`
+	result, err = d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"bytes=0-2499", "bytes=2500-4999", "bytes=5000-7499", "bytes=7500-9999"}, rangesAsked)
+	written, _ = ioutil.ReadFile(result.Path)
+	assert.Equal(t, content, written)
+}
+
+func TestResumeStateMissing(t *testing.T) {
+	state := &resumeState{Size: 100, Segmented: true}
+	assert.Equal(t, []segment{{0, 99}}, state.missing())
+	state.Completed = []segment{{50, 74}, {0, 24}}
+	assert.Equal(t, []segment{{25, 49}, {75, 99}}, state.missing())
+	state.Completed = append(state.Completed, segment{25, 49}, segment{75, 99})
+	assert.Empty(t, state.missing())
+}
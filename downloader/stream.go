@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultStreamConcurrency is the number of segments fetched at the same time when none is configured
+const defaultStreamConcurrency = 4
+
+// segmentsSuffix is appended to the partial file to name the directory holding finished segments
+const segmentsSuffix = ".segments"
+
+// segmentExtension is the extension of the finished segments in their directory
+const segmentExtension = ".segment"
+
+// streamSegment is a piece of a stream delivered in many files, HLS or DASH
+type streamSegment struct {
+	URI      string
+	Duration float64
+	// Sequence is the media sequence number of the segment, used as IV when the key has none
+	Sequence int64
+	// Key tells how the segment is encrypted, nil when it is not
+	Key *hlsKey
+	// Offset and Length describe a sub-range of URI, Length is -1 for the whole resource
+	Offset int64
+	Length int64
+}
+
+// streamState identifies the playlist or manifest the segments directory was filled from, segments
+// of another one can't be reused
+type streamState struct {
+	URL      string `json:"url"`
+	Segments int    `json:"segments"`
+}
+
+// downloadSegmentedStream - Fetch the pieces of the stream identified by sourceURL and write them
+// one after the other into partialPath. Pieces are downloaded concurrently, each one kept in a
+// directory next to partialPath until they are all there, so an interrupted download only fetches
+// the missing ones. Returns the size of the stream
+func (d *Downloader) downloadSegmentedStream(ctx context.Context, sourceURL string, pieces []streamSegment, concurrency int, partialPath string, tracker *progressTracker) (int64, error) {
+	if concurrency <= 0 {
+		concurrency = defaultStreamConcurrency
+	}
+	segmentsDir := partialPath + segmentsSuffix
+	if err := prepareSegmentsDir(segmentsDir, streamState{URL: sourceURL, Segments: len(pieces)}); nil != err {
+		return -1, err
+	}
+
+	// Segments finished by a previous run are not fetched again
+	var resumed int64
+	var missing []int
+	for i := range pieces {
+		if info, err := os.Stat(segmentPath(segmentsDir, i)); nil == err {
+			resumed += info.Size()
+			continue
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) < len(pieces) {
+		logrus.Infof("Resume stream [%s], [%d/%d] segments left", sourceURL, len(missing), len(pieces))
+	}
+	tracker.begin(resumed, -1)
+
+	keys := &hlsKeys{keys: map[string][]byte{}, policy: d.Retry, client: d.httpClient()}
+	if err := d.downloadStreamSegments(ctx, pieces, missing, concurrency, segmentsDir, keys, tracker); nil != err {
+		return -1, errors.Wrapf(err, "Error downloading stream [%s]", sourceURL)
+	}
+
+	size, err := concatenateSegments(segmentsDir, len(pieces), partialPath)
+	if nil != err {
+		return -1, err
+	}
+	os.RemoveAll(segmentsDir)
+	return size, nil
+}
+
+// prepareSegmentsDir - Create the directory holding the finished segments, emptied when it was
+// filled from another playlist
+func prepareSegmentsDir(segmentsDir string, state streamState) error {
+	statePath := filepath.Join(segmentsDir, "playlist"+stateSuffix)
+	if content, err := ioutil.ReadFile(statePath); nil == err {
+		var previous streamState
+		if nil == json.Unmarshal(content, &previous) && previous == state {
+			return nil
+		}
+		logrus.Infof("Segments in [%s] come from another playlist, download them again", segmentsDir)
+	}
+	os.RemoveAll(segmentsDir)
+
+	if err := os.MkdirAll(segmentsDir, 0777); nil != err {
+		return errors.Wrapf(err, "Error creating segments directory [%s]", segmentsDir)
+	}
+	content, err := json.Marshal(state)
+	if nil != err {
+		return errors.Wrap(err, "Error encoding stream state")
+	}
+	return errors.Wrapf(ioutil.WriteFile(statePath, content, 0666), "Error writing stream state [%s]", statePath)
+}
+
+// segmentPath - Returns the file holding the finished segment i
+func segmentPath(segmentsDir string, i int) string {
+	return filepath.Join(segmentsDir, fmt.Sprintf("%06d%s", i, segmentExtension))
+}
+
+// downloadStreamSegments - Fetch the pieces listed in missing with at most concurrency at a time
+func (d *Downloader) downloadStreamSegments(ctx context.Context, pieces []streamSegment, missing []int, concurrency int, segmentsDir string, keys *hlsKeys, tracker *progressTracker) error {
+	// The first segment failing stops all the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	errs := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				description := fmt.Sprintf("downloading segment [%d] [%s]", i, pieces[i].URI)
+				err := d.Retry.DoContext(ctx, description, func() error {
+					return d.downloadStreamSegment(ctx, pieces[i], segmentPath(segmentsDir, i), keys, tracker)
+				})
+				if nil != err {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, i := range missing {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// downloadStreamSegment - Fetch s, decrypt it and write it to path. The file only appears once
+// complete, a partially written segment is never taken for a finished one
+func (d *Downloader) downloadStreamSegment(ctx context.Context, s streamSegment, path string, keys *hlsKeys, tracker *progressTracker) error {
+	req, err := http.NewRequest(http.MethodGet, s.URI, nil)
+	if nil != err {
+		return errors.Wrapf(err, "Error creating request for segment [%s]", s.URI)
+	}
+	req = req.WithContext(ctx)
+	if s.Length >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", s.Offset, s.Offset+s.Length-1))
+	}
+	resp, err := d.httpClient().Do(req)
+	if nil != err {
+		return errors.Wrapf(err, "Error fetching segment [%s]", s.URI)
+	}
+	defer resp.Body.Close()
+	if err = retry.CheckStatus(resp); nil != err {
+		return err
+	}
+	if s.Length >= 0 && !isResumedResponse(resp, s.Offset) {
+		return fmt.Errorf("Server did not answer range [%d-%d] of segment [%s], got status [%s]", s.Offset, s.Offset+s.Length-1, s.URI, resp.Status)
+	}
+
+	var content bytes.Buffer
+	written, err := streamBody(tracker.wrap(&content), resp)
+	if nil != err {
+		// The whole segment is downloaded again by the next attempt
+		tracker.add(-written)
+		return errors.Wrapf(err, "Error fetching segment [%s]", s.URI)
+	}
+
+	data := content.Bytes()
+	if nil != s.Key {
+		key, err := keys.get(ctx, s.Key.URI)
+		if nil != err {
+			return err
+		}
+		if data, err = decryptSegment(data, key, segmentIV(s)); nil != err {
+			return errors.Wrapf(err, "Error decrypting segment [%s]", s.URI)
+		}
+	}
+
+	temporaryPath := path + partialSuffix
+	if err = ioutil.WriteFile(temporaryPath, data, 0666); nil != err {
+		return errors.Wrapf(err, "Error writing segment [%s]", temporaryPath)
+	}
+	return errors.Wrapf(os.Rename(temporaryPath, path), "Error moving segment to [%s]", path)
+}
+
+// concatenateSegments - Write the count segments of segmentsDir one after the other into
+// partialPath. Returns the size of the result
+func concatenateSegments(segmentsDir string, count int, partialPath string) (int64, error) {
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	if nil != err {
+		return -1, errors.Wrapf(err, "Error creating destination file [%s]", partialPath)
+	}
+	defer file.Close()
+
+	var size int64
+	buffer := make([]byte, copyBufferSize)
+	for i := 0; i < count; i++ {
+		segment, err := os.Open(segmentPath(segmentsDir, i))
+		if nil != err {
+			return -1, errors.Wrapf(err, "Error opening segment [%d]", i)
+		}
+		written, err := io.CopyBuffer(file, segment, buffer)
+		segment.Close()
+		if nil != err {
+			return -1, errors.Wrapf(err, "Error appending segment [%d] to [%s]", i, partialPath)
+		}
+		size += written
+	}
+	if err = syncAndClose(file); nil != err {
+		return -1, err
+	}
+	return size, nil
+}
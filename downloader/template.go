@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// missingField replaces a template field the extractor could not resolve
+const missingField = "NA"
+
+// templateFieldRegexp matches a `{field}` of an output template
+var templateFieldRegexp = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// templateFields returns the value of every field available in an output template
+func templateFields(vi *VideoInfos) map[string]string {
+	return map[string]string{
+		"id":       vi.ID,
+		"site":     vi.Site,
+		"uploader": vi.Uploader,
+		"date":     vi.Date,
+		"title":    vi.Title,
+		"ext":      strings.TrimPrefix(vi.Extension, "."),
+	}
+}
+
+// renderOutputTemplate - Build the path of the video, relative to the destination, from a template
+// such as `{site}/{uploader}/{date}-{title}.{ext}`. Every field is sanitised so it can't create
+// directories on its own; the title falls back to the ID and other empty fields are rendered as `NA`
+func renderOutputTemplate(template string, vi *VideoInfos) (string, error) {
+	if nil == vi {
+		return "", errors.New("Uninitalized parameters provided")
+	}
+	if "" == template {
+		return "", errors.New("Empty output template")
+	}
+
+	fields := templateFields(vi)
+	var unknownField string
+	rendered := templateFieldRegexp.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, exist := fields[name]
+		if !exist {
+			unknownField = name
+			return match
+		}
+		value = sanitizeFilename(value)
+		if "" == value && "title" == name {
+			value = sanitizeFilename(vi.ID)
+		}
+		if "" == value {
+			return missingField
+		}
+		return value
+	})
+	if "" != unknownField {
+		return "", fmt.Errorf("Unknown field [%s] in output template [%s]", unknownField, template)
+	}
+
+	// The template itself must not lead outside of the destination
+	rendered = filepath.Clean(filepath.FromSlash(rendered))
+	if filepath.IsAbs(rendered) || ".." == rendered || strings.HasPrefix(rendered, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Output template [%s] leads outside of the destination", template)
+	}
+
+	components := strings.Split(rendered, string(filepath.Separator))
+	for i, component := range components {
+		components[i] = truncateFilename(component, maxFilenameBytes)
+	}
+	return filepath.Join(components...), nil
+}
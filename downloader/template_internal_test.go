@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderOutputTemplate(t *testing.T) {
+	vi := &VideoInfos{
+		ID:        "abc123",
+		Site:      "u",
+		Uploader:  "some/one",
+		Date:      "20180907",
+		Title:     "My title",
+		Extension: ".mp4",
+	}
+
+	type expectedResult struct {
+		path string
+		err  string
+	}
+	cases := map[string]expectedResult{
+		"{id}.{ext}": expectedResult{
+			path: "abc123.mp4",
+		},
+		"{site}/{uploader}/{date}-{title}.{ext}": expectedResult{
+			path: filepath.Join("u", "some_one", "20180907-My title.mp4"),
+		},
+		"{id}-{unknown}.{ext}": expectedResult{
+			err: "Unknown field [unknown] in output template [{id}-{unknown}.{ext}]",
+		},
+		"../{id}.{ext}": expectedResult{
+			err: "Output template [../{id}.{ext}] leads outside of the destination",
+		},
+		"/tmp/{id}.{ext}": expectedResult{
+			err: "Output template [/tmp/{id}.{ext}] leads outside of the destination",
+		},
+	}
+
+	for template, expected := range cases {
+		path, err := renderOutputTemplate(template, vi)
+		assert.Equal(t, expected.path, path, template)
+		if "" == expected.err {
+			assert.Nil(t, err, template)
+		} else {
+			assert.EqualError(t, err, expected.err, template)
+		}
+	}
+
+	// Missing and malicious fields can't escape
+	vi = &VideoInfos{Title: "..", Extension: "mp4"}
+	path, err := renderOutputTemplate("{uploader}/{title}.{ext}", vi)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("NA", "NA.mp4"), path)
+
+	_, err = renderOutputTemplate("", vi)
+	assert.EqualError(t, err, "Empty output template")
+}
+
+func TestGetVideoOutputTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	destinationPath, err := ioutil.TempDir("", "template")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(destinationPath)
+
+	d := &Downloader{OutputTemplate: "{site}/{id}.{ext}"}
+	vi := &VideoInfos{URL: server.URL, ID: "abc123", Site: "u", Title: "title", Extension: ".mp4"}
+	result, err := d.GetVideo(context.Background(), vi, destinationPath)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(destinationPath, "u", "abc123.mp4"), result.Path)
+	content, _ := ioutil.ReadFile(result.Path)
+	assert.Equal(t, "video", string(content))
+}
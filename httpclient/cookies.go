@@ -0,0 +1,277 @@
+package httpclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// httpOnlyPrefix marks the HttpOnly cookies of a Netscape file, the line is not a comment
+const httpOnlyPrefix = "#HttpOnly_"
+
+// netscapeHeader is the first line of the Netscape files written
+const netscapeHeader = "# Netscape HTTP Cookie File"
+
+// Cookie is a line of a Netscape cookies.txt file
+type Cookie struct {
+	// Domain is the host the cookie is sent to, its subdomains as well when IncludeSubdomains
+	Domain            string
+	IncludeSubdomains bool
+	Path              string
+	Secure            bool
+	HTTPOnly          bool
+	// Expires is zero for the cookies of the session
+	Expires time.Time
+	Name    string
+	Value   string
+}
+
+// expired - Check the cookie must not be sent anymore
+func (c *Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// key - Returns what identifies the cookie, a newer one with the same key replaces it
+func (c *Cookie) key() string {
+	return fmt.Sprintf("%s;%t;%s;%s", c.Domain, c.IncludeSubdomains, c.Path, c.Name)
+}
+
+// ReadCookies - Returns the cookies of a Netscape cookies.txt file
+func ReadCookies(r io.Reader) ([]*Cookie, error) {
+	var cookies []*Cookie
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(text, httpOnlyPrefix)
+		if httpOnly {
+			text = text[len(httpOnlyPrefix):]
+		}
+		if "" == strings.TrimSpace(text) || (!httpOnly && strings.HasPrefix(text, "#")) {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if 7 != len(fields) {
+			return nil, fmt.Errorf("Invalid cookie at line [%d], [7] fields separated by tabs are expected, got [%d]", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if nil != err {
+			return nil, errors.Wrapf(err, "Invalid expiration [%s] of cookie at line [%d]", fields[4], line)
+		}
+		cookie := &Cookie{
+			Domain:            strings.ToLower(fields[0]),
+			IncludeSubdomains: strings.EqualFold("TRUE", fields[1]),
+			Path:              fields[2],
+			Secure:            strings.EqualFold("TRUE", fields[3]),
+			HTTPOnly:          httpOnly,
+			Name:              fields[5],
+			Value:             fields[6],
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		if "" == strings.TrimPrefix(cookie.Domain, ".") || "" == cookie.Name {
+			return nil, fmt.Errorf("Invalid cookie at line [%d], a domain and a name are expected", line)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, errors.Wrap(err, "Error reading cookies")
+	}
+	return cookies, nil
+}
+
+// WriteCookies - Write cookies in the Netscape cookies.txt format
+func WriteCookies(w io.Writer, cookies []*Cookie) error {
+	buffer := bufio.NewWriter(w)
+	fmt.Fprintln(buffer, netscapeHeader)
+	for _, c := range cookies {
+		prefix := ""
+		if c.HTTPOnly {
+			prefix = httpOnlyPrefix
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		fmt.Fprintf(buffer, "%s%s\t%s\t%s\t%s\t%d\t%s\t%s\n", prefix, c.Domain, netscapeBool(c.IncludeSubdomains), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+	}
+	return buffer.Flush()
+}
+
+func netscapeBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// CookieJar is an http.CookieJar remembering every cookie it holds, so they can be saved back to
+// a Netscape file. It can be shared by many clients and used concurrently
+type CookieJar struct {
+	jar     *cookiejar.Jar
+	mutex   sync.Mutex
+	cookies map[string]*Cookie
+}
+
+// NewCookieJar - Returns an empty jar
+func NewCookieJar() *CookieJar {
+	// Without a public suffix list any domain is accepted, as browsers exporting the file did
+	jar, _ := cookiejar.New(nil)
+	return &CookieJar{jar: jar, cookies: map[string]*Cookie{}}
+}
+
+// Cookies - Implements http.CookieJar
+func (cj *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return cj.jar.Cookies(u)
+}
+
+// SetCookies - Implements http.CookieJar
+func (cj *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	cj.jar.SetCookies(u, cookies)
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+	now := time.Now()
+	host := strings.ToLower(u.Hostname())
+	for _, c := range cookies {
+		cookie := &Cookie{
+			Domain:   host,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+			Name:     c.Name,
+			Value:    c.Value,
+		}
+		if "" != c.Domain {
+			domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+			// The jar refuses the cookies of another domain
+			if host != domain && !strings.HasSuffix(host, "."+domain) {
+				continue
+			}
+			cookie.Domain = "." + domain
+			cookie.IncludeSubdomains = true
+		}
+		if "" == cookie.Path || !strings.HasPrefix(cookie.Path, "/") {
+			cookie.Path = defaultPath(u.Path)
+		}
+		switch {
+		case c.MaxAge < 0:
+			cookie.Expires = now
+		case c.MaxAge > 0:
+			cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		default:
+			cookie.Expires = c.Expires
+		}
+
+		if cookie.expired(now) {
+			delete(cj.cookies, cookie.key())
+		} else {
+			cj.cookies[cookie.key()] = cookie
+		}
+	}
+}
+
+// defaultPath - Returns the path of the cookies not setting one, see RFC 6265 section 5.1.4
+func defaultPath(requestPath string) string {
+	i := strings.LastIndex(requestPath, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return requestPath[:i]
+}
+
+// Add - Put cookies in the jar, the expired ones are ignored
+func (cj *CookieJar) Add(cookies []*Cookie) {
+	now := time.Now()
+	for _, c := range cookies {
+		if c.expired(now) {
+			continue
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		host := strings.TrimPrefix(c.Domain, ".")
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		cookie := &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Secure: c.Secure, HttpOnly: c.HTTPOnly, Expires: c.Expires}
+		if c.IncludeSubdomains && nil == net.ParseIP(strings.TrimPrefix(c.Domain, ".")) {
+			cookie.Domain = host
+		}
+		cj.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: c.Path}, []*http.Cookie{cookie})
+	}
+}
+
+// All - Returns the cookies of the jar not expired yet, sorted by domain, path and name
+func (cj *CookieJar) All() []*Cookie {
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+	now := time.Now()
+	var cookies []*Cookie
+	for _, c := range cj.cookies {
+		if !c.expired(now) {
+			cookie := *c
+			cookies = append(cookies, &cookie)
+		}
+	}
+	sort.Slice(cookies, func(i, j int) bool {
+		return cookies[i].key() < cookies[j].key()
+	})
+	return cookies
+}
+
+// Load - Add the cookies of the Netscape file at path
+func (cj *CookieJar) Load(path string) error {
+	file, err := os.Open(path)
+	if nil != err {
+		return errors.Wrapf(err, "Error opening cookies file [%s]", path)
+	}
+	defer file.Close()
+	cookies, err := ReadCookies(file)
+	if nil != err {
+		return errors.Wrapf(err, "Error parsing cookies file [%s]", path)
+	}
+	cj.Add(cookies)
+	return nil
+}
+
+// Save - Write the cookies of the jar in the Netscape file at path, replacing it at once so a
+// failure never leaves it half written. A replaced file keeps its mode, a new one is only readable
+// by its owner
+func (cj *CookieJar) Save(path string) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if nil != err {
+		return errors.Wrapf(err, "Error creating cookies file next to [%s]", path)
+	}
+	defer os.Remove(file.Name())
+
+	if info, statErr := os.Stat(path); nil == statErr {
+		err = file.Chmod(info.Mode().Perm())
+	}
+	if nil == err {
+		err = WriteCookies(file, cj.All())
+	}
+	if closeErr := file.Close(); nil == err {
+		err = closeErr
+	}
+	if nil != err {
+		return errors.Wrapf(err, "Error writing cookies file [%s]", path)
+	}
+	return errors.Wrapf(os.Rename(file.Name(), path), "Error replacing cookies file [%s]", path)
+}
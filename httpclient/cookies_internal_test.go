@@ -0,0 +1,138 @@
+package httpclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCookies(t *testing.T) {
+	content := "# Netscape HTTP Cookie File\n" +
+		"# This is a generated file! Do not edit.\n" +
+		"\n" +
+		".u.test\tTRUE\t/\tTRUE\t1893456000\tsession\tabc\r\n" +
+		"#HttpOnly_www.u.test\tFALSE\t/watch\tFALSE\t0\tlogin\tx=y\n"
+	cookies, err := ReadCookies(strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, []*Cookie{
+		{Domain: ".u.test", IncludeSubdomains: true, Path: "/", Secure: true, Expires: time.Unix(1893456000, 0), Name: "session", Value: "abc"},
+		{Domain: "www.u.test", Path: "/watch", HTTPOnly: true, Name: "login", Value: "x=y"},
+	}, cookies)
+
+	// Right case - what is written is read back
+	var written bytes.Buffer
+	assert.Nil(t, WriteCookies(&written, cookies))
+	assert.Equal(t, "# Netscape HTTP Cookie File\n"+
+		".u.test\tTRUE\t/\tTRUE\t1893456000\tsession\tabc\n"+
+		"#HttpOnly_www.u.test\tFALSE\t/watch\tFALSE\t0\tlogin\tx=y\n", written.String())
+	readBack, err := ReadCookies(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, cookies, readBack)
+
+	// Wrong cases
+	_, err = ReadCookies(strings.NewReader("# comment\nu.test TRUE / FALSE 0 name value\n"))
+	assert.EqualError(t, err, "Invalid cookie at line [2], [7] fields separated by tabs are expected, got [1]")
+	_, err = ReadCookies(strings.NewReader("u.test\tTRUE\t/\tFALSE\tnever\tname\tvalue\n"))
+	assert.EqualError(t, err, "Invalid expiration [never] of cookie at line [1]: strconv.ParseInt: parsing \"never\": invalid syntax")
+	_, err = ReadCookies(strings.NewReader(".\tTRUE\t/\tFALSE\t0\tname\tvalue\n"))
+	assert.EqualError(t, err, "Invalid cookie at line [1], a domain and a name are expected")
+}
+
+func TestCookieJar(t *testing.T) {
+	jar := NewCookieJar()
+	expired := time.Now().Add(-time.Hour)
+	jar.Add([]*Cookie{
+		{Domain: ".u.test", IncludeSubdomains: true, Path: "/", Name: "session", Value: "abc"},
+		{Domain: "www.u.test", Path: "/", Name: "host", Value: "only"},
+		{Domain: "www.u.test", Path: "/", Name: "old", Value: "expired", Expires: expired},
+	})
+
+	cookieNames := func(rawURL string) []string {
+		u, _ := url.Parse(rawURL)
+		var names []string
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name+"="+c.Value)
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"session=abc", "host=only"}, cookieNames("http://www.u.test/watch"))
+	assert.Equal(t, []string{"session=abc"}, cookieNames("http://cdn.u.test/video.mp4"))
+	assert.Empty(t, cookieNames("http://other.test/"))
+
+	// Right case - cookies received are kept, updated and removed
+	u, _ := url.Parse("https://www.u.test/account/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "def", Domain: "u.test", Path: "/", HttpOnly: true},
+		{Name: "host", MaxAge: -1, Path: "/"},
+		{Name: "token", Value: "t", MaxAge: 3600},
+		{Name: "foreign", Value: "f", Domain: "other.test"},
+	})
+	all := jar.All()
+	if assert.Len(t, all, 2) {
+		assert.Equal(t, &Cookie{Domain: ".u.test", IncludeSubdomains: true, Path: "/", HTTPOnly: true, Name: "session", Value: "def"}, all[0])
+		assert.Equal(t, "www.u.test", all[1].Domain)
+		assert.Equal(t, "/account", all[1].Path)
+		assert.Equal(t, "token", all[1].Name)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), all[1].Expires, time.Minute)
+	}
+	assert.Equal(t, []string{"session=def"}, cookieNames("http://www.u.test/watch"))
+}
+
+func TestCookieJarFile(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Cookie")
+		http.SetCookie(w, &http.Cookie{Name: "visits", Value: "2", Path: "/"})
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	directory, err := ioutil.TempDir("", "cookies")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(directory)
+	cookiesPath := filepath.Join(directory, "cookies.txt")
+	assert.Nil(t, ioutil.WriteFile(cookiesPath, []byte(serverURL.Hostname()+"\tFALSE\t/\tFALSE\t0\tvisits\t1\n"), 0600))
+	assert.Nil(t, os.Chmod(cookiesPath, 0644))
+
+	// Right case - the cookies of the file are sent, the updated ones saved back
+	jar := NewCookieJar()
+	assert.Nil(t, jar.Load(cookiesPath))
+	client, err := New(Options{Jar: jar}, Timeouts{})
+	assert.Nil(t, err)
+	resp, err := client.Get(server.URL)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, "visits=1", received)
+	}
+	assert.Nil(t, jar.Save(cookiesPath))
+	saved, _ := ioutil.ReadFile(cookiesPath)
+	assert.Equal(t, "# Netscape HTTP Cookie File\n"+serverURL.Hostname()+"\tFALSE\t/\tFALSE\t0\tvisits\t2\n", string(saved))
+	files, _ := ioutil.ReadDir(directory)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, os.FileMode(0644), files[0].Mode().Perm())
+	}
+
+	// Right case - a new file is only readable by its owner
+	newPath := filepath.Join(directory, "new.txt")
+	assert.Nil(t, jar.Save(newPath))
+	if info, err := os.Stat(newPath); assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// Wrong case - no such file
+	err = jar.Load(filepath.Join(directory, "missing.txt"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Error opening cookies file")
+	}
+}
@@ -0,0 +1,194 @@
+package httpclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverride(t *testing.T) {
+	global := Timeouts{Connect: 10 * time.Second, Idle: time.Minute}
+	assert.Equal(t, global, global.Override(Timeouts{}))
+	assert.Equal(t, Timeouts{Connect: 10 * time.Second, Idle: -1, Total: time.Hour}, global.Override(Timeouts{Idle: -1, Total: time.Hour}))
+}
+
+func TestTimeout(t *testing.T) {
+	assert.Equal(t, DefaultIdle, timeout(0, DefaultIdle))
+	assert.Equal(t, time.Duration(0), timeout(-1, DefaultIdle))
+	assert.Equal(t, time.Second, timeout(time.Second, DefaultIdle))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first bytes"))
+		w.(http.Flusher).Flush()
+		if "/stall" == r.URL.Path {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Options{}, Timeouts{Idle: 100 * time.Millisecond})
+	assert.Nil(t, err)
+
+	// Right case - the body is read before the server stops sending
+	resp, err := client.Get(server.URL + "/quick")
+	if assert.Nil(t, err) {
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "first bytes", string(content))
+	}
+
+	// Wrong case - the server stops sending in the middle of the body
+	resp, err = client.Get(server.URL + "/stall")
+	if assert.Nil(t, err) {
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "first bytes", string(content))
+		assert.IsType(t, &IdleTimeoutError{}, err)
+		netErr, ok := err.(net.Error)
+		assert.True(t, ok && netErr.Timeout())
+		assert.EqualError(t, err, "No data received from ["+server.URL+"/stall] for [100ms]")
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Options{}, Timeouts{Header: 100 * time.Millisecond})
+	assert.Nil(t, err)
+	start := time.Now()
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// Wrong case - the whole request is bounded as well
+	client, err = New(Options{}, Timeouts{Header: -1, Total: 100 * time.Millisecond})
+	assert.Nil(t, err)
+	start = time.Now()
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestOptionsOverride(t *testing.T) {
+	global := Options{Proxy: "http://proxy.test:3128", UserAgent: "global", Headers: map[string]string{"Referer": "https://global.test/", "X-Global": "1"}}
+	assert.Equal(t, global, global.Override(Options{}))
+	assert.Equal(t, Options{
+		Proxy:        "http://proxy.test:3128",
+		UserAgent:    "site",
+		Headers:      map[string]string{"Referer": "https://site.test/", "X-Global": "1"},
+		MaxRedirects: 2,
+	}, global.Override(Options{UserAgent: "site", Headers: map[string]string{"Referer": "https://site.test/"}, MaxRedirects: 2}))
+	// The global headers are left untouched
+	assert.Equal(t, "https://global.test/", global.Headers["Referer"])
+}
+
+func TestHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+
+	// Right case - the Go user agent is never sent
+	client, err := New(Options{}, Timeouts{})
+	assert.Nil(t, err)
+	resp, err := client.Get(server.URL)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, DefaultUserAgent, received.Get("User-Agent"))
+	}
+
+	// Right case - configured headers are added, those of the request win
+	client, err = New(Options{UserAgent: "agent/1.0", Headers: map[string]string{"referer": "https://site.test/", "Range": "bytes=0-"}}, Timeouts{})
+	assert.Nil(t, err)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Range", "bytes=10-")
+	resp, err = client.Do(req)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, "agent/1.0", received.Get("User-Agent"))
+		assert.Equal(t, "https://site.test/", received.Get("Referer"))
+		assert.Equal(t, "bytes=10-", received.Get("Range"))
+	}
+	// The request given is left untouched
+	assert.Empty(t, req.Header.Get("Referer"))
+}
+
+func TestMaxRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hops int
+		fmt.Sscanf(r.URL.Path, "/%d", &hops)
+		if hops > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/%d", hops-1), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Options{MaxRedirects: 2}, Timeouts{})
+	assert.Nil(t, err)
+	resp, err := client.Get(server.URL + "/2")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	_, err = client.Get(server.URL + "/3")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Stopped after [2] redirects")
+	}
+
+	// Right case - redirects are not followed
+	client, err = New(Options{MaxRedirects: -1}, Timeouts{})
+	assert.Nil(t, err)
+	resp, err = client.Get(server.URL + "/1")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := New(Options{Proxy: proxy.URL}, Timeouts{})
+	assert.Nil(t, err)
+	resp, err := client.Get("http://video.test/watch")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, "http://video.test/watch", proxied)
+	}
+
+	_, err = New(Options{Proxy: "socks5://localhost:1080"}, Timeouts{})
+	assert.Nil(t, err)
+
+	// Wrong cases
+	_, err = New(Options{Proxy: "ftp://localhost:21"}, Timeouts{})
+	assert.EqualError(t, err, "Invalid proxy [ftp://localhost:21], expected an URL such as [http://host:port], [https://host:port] or [socks5://host:port]")
+	_, err = New(Options{Proxy: "localhost:1080"}, Timeouts{})
+	assert.NotNil(t, err)
+}
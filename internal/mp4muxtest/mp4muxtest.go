@@ -0,0 +1,104 @@
+// Package mp4muxtest builds fragmented MP4 files for the tests of the packages muxing them
+package mp4muxtest
+
+import (
+	"encoding/binary"
+)
+
+// boxHeaderSize is the size of a box header holding a 32 bits size
+const boxHeaderSize = 8
+
+// Uint32Bytes - Returns values as big endian bytes, the encoding of MP4 box fields
+func Uint32Bytes(values ...uint32) []byte {
+	content := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint32(content[4*i:], value)
+	}
+	return content
+}
+
+// MakeBox - Returns a box of type boxType holding payload
+func MakeBox(boxType string, payload ...[]byte) []byte {
+	size := boxHeaderSize
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := make([]byte, boxHeaderSize, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:8], boxType)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// header - Returns the `ftyp` and `moov` boxes of a fragmented MP4 of a single track
+func header(trackID uint32, handler string, timescale uint32) []byte {
+	tkhd := MakeBox("tkhd", Uint32Bytes(0, 0, 0, trackID), make([]byte, 68))
+	mdhd := MakeBox("mdhd", Uint32Bytes(0, 0, 0, timescale, 0, 0))
+	hdlr := MakeBox("hdlr", Uint32Bytes(0, 0), []byte(handler), make([]byte, 13))
+	trak := MakeBox("trak", tkhd, MakeBox("mdia", mdhd, hdlr))
+	mvhd := MakeBox("mvhd", make([]byte, 96), Uint32Bytes(trackID+1))
+	trex := MakeBox("trex", Uint32Bytes(0, trackID, 1, 0, 0, 0))
+	return append(MakeBox("ftyp", []byte("iso6"), Uint32Bytes(0), []byte("iso6dash")), MakeBox("moov", mvhd, trak, MakeBox("mvex", trex))...)
+}
+
+// FragmentedMP4 - Returns a fragmented MP4 of a single track numbered trackID, holding one fragment
+// per sample, each one decoded at times[i] in timescale units. The fragments use absolute data offsets
+func FragmentedMP4(trackID uint32, handler string, timescale uint32, times []uint64, samples []string) []byte {
+	file := append(header(trackID, handler, timescale), MakeBox("sidx", make([]byte, 12))...)
+
+	for i, sample := range samples {
+		tfdt := MakeBox("tfdt", Uint32Bytes(1<<24), make([]byte, 8))
+		binary.BigEndian.PutUint64(tfdt[12:], times[i])
+		tfhd := MakeBox("tfhd", Uint32Bytes(1, trackID), make([]byte, 8))
+		moof := MakeBox("moof", MakeBox("mfhd", Uint32Bytes(0, uint32(i+1))), MakeBox("traf", tfhd, tfdt))
+		// base_data_offset points to the mdat payload
+		binary.BigEndian.PutUint64(moof[len(moof)-len(tfdt)-8:], uint64(len(file)+len(moof)+boxHeaderSize))
+		file = append(file, moof...)
+		file = append(file, MakeBox("mdat", []byte(sample))...)
+	}
+	return file
+}
+
+// Fragment is a fragment of a single sample, see FragmentedMP4Of
+type Fragment struct {
+	// Time is the decode time of the `tfdt` box, the box is left out when nil
+	Time *uint64
+	// Duration of the sample, in timescale units
+	Duration uint32
+	// Between are boxes, such as `emsg`, written between the `moof` and the `mdat`
+	Between [][]byte
+	Sample  string
+}
+
+// FragmentedMP4Of - Returns a fragmented MP4 of a single track numbered trackID, holding the
+// fragments. The fragments locate their sample with a `trun` data offset relative to the `moof`
+func FragmentedMP4Of(trackID uint32, handler string, timescale uint32, fragments []Fragment) []byte {
+	file := header(trackID, handler, timescale)
+	for i, f := range fragments {
+		// default-base-is-moof
+		traf := [][]byte{MakeBox("tfhd", Uint32Bytes(0x020000, trackID))}
+		if nil != f.Time {
+			tfdt := MakeBox("tfdt", Uint32Bytes(1<<24), make([]byte, 8))
+			binary.BigEndian.PutUint64(tfdt[12:], *f.Time)
+			traf = append(traf, tfdt)
+		}
+		// data-offset-present and sample-duration-present, for one sample
+		trun := MakeBox("trun", Uint32Bytes(0x000101, 1, 0, f.Duration))
+		traf = append(traf, trun)
+		moof := MakeBox("moof", MakeBox("mfhd", Uint32Bytes(0, uint32(i+1))), MakeBox("traf", traf...))
+
+		dataOffset := len(moof) + boxHeaderSize
+		for _, box := range f.Between {
+			dataOffset += len(box)
+		}
+		binary.BigEndian.PutUint32(moof[len(moof)-8:], uint32(dataOffset))
+		file = append(file, moof...)
+		for _, box := range f.Between {
+			file = append(file, box...)
+		}
+		file = append(file, MakeBox("mdat", []byte(f.Sample))...)
+	}
+	return file
+}
@@ -0,0 +1,147 @@
+package mp4mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// boxHeaderSize is the size of a box header without the 64 bits extended size
+const boxHeaderSize = 8
+
+// maxMetadataBoxSize bounds the boxes loaded in memory to be rewritten (`moov`, `moof`)
+const maxMetadataBoxSize = 64 * 1024 * 1024
+
+// boxInfo locates a box in a file
+type boxInfo struct {
+	Type string
+	// Offset is the position of the box header
+	Offset int64
+	// Size is the size of the whole box, header included
+	Size int64
+	// HeaderSize is 8, or 16 when the box uses a 64 bits size
+	HeaderSize int64
+}
+
+// readBoxes - Returns the top level boxes of r, which holds size bytes
+func readBoxes(r io.ReaderAt, size int64) ([]boxInfo, error) {
+	var boxes []boxInfo
+	header := make([]byte, 16)
+	for offset := int64(0); offset < size; {
+		if size-offset < boxHeaderSize {
+			return nil, fmt.Errorf("Truncated box header at [%d]", offset)
+		}
+		if _, err := r.ReadAt(header[:boxHeaderSize], offset); nil != err {
+			return nil, errors.Wrapf(err, "Error reading box header at [%d]", offset)
+		}
+		box := boxInfo{Type: string(header[4:8]), Offset: offset, Size: int64(binary.BigEndian.Uint32(header)), HeaderSize: boxHeaderSize}
+		switch box.Size {
+		case 0:
+			// The box extends to the end of the file
+			box.Size = size - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); nil != err {
+				return nil, errors.Wrapf(err, "Error reading box size at [%d]", offset)
+			}
+			box.Size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.HeaderSize = 16
+		}
+		if box.Size < box.HeaderSize || box.Size > size-offset {
+			return nil, fmt.Errorf("Invalid size [%d] of box [%s] at [%d]", box.Size, box.Type, offset)
+		}
+		boxes = append(boxes, box)
+		offset += box.Size
+	}
+	return boxes, nil
+}
+
+// loadBox - Read the whole box in memory
+func loadBox(r io.ReaderAt, box boxInfo) ([]byte, error) {
+	if box.Size > maxMetadataBoxSize {
+		return nil, fmt.Errorf("Box [%s] of [%d] bytes is too big", box.Type, box.Size)
+	}
+	content := make([]byte, box.Size)
+	if _, err := r.ReadAt(content, box.Offset); nil != err {
+		return nil, errors.Wrapf(err, "Error reading box [%s] at [%d]", box.Type, box.Offset)
+	}
+	return content, nil
+}
+
+// child is a box nested in a loaded box
+type child struct {
+	Type string
+	// Start is the position of the child header in the loaded box
+	Start int
+	// PayloadStart is the position of the child payload, End the position after the child
+	PayloadStart int
+	End          int
+}
+
+// children - Returns the boxes inside content[start:end]
+func children(content []byte, start int, end int) ([]child, error) {
+	var found []child
+	for offset := start; offset < end; {
+		if end-offset < boxHeaderSize {
+			return nil, fmt.Errorf("Truncated box header at [%d]", offset)
+		}
+		c := child{Type: string(content[offset+4 : offset+8]), Start: offset, PayloadStart: offset + boxHeaderSize}
+		size := int64(binary.BigEndian.Uint32(content[offset:]))
+		switch size {
+		case 0:
+			size = int64(end - offset)
+		case 1:
+			if end-offset < 16 {
+				return nil, fmt.Errorf("Truncated box header at [%d]", offset)
+			}
+			size = int64(binary.BigEndian.Uint64(content[offset+8:]))
+			c.PayloadStart += 8
+		}
+		if size < int64(c.PayloadStart-offset) || size > int64(end-offset) {
+			return nil, fmt.Errorf("Invalid size [%d] of box [%s] at [%d]", size, c.Type, offset)
+		}
+		c.End = offset + int(size)
+		found = append(found, c)
+		offset = c.End
+	}
+	return found, nil
+}
+
+// findChild - Returns the first child of type boxType, following the path of types given
+func findChild(content []byte, start int, end int, path ...string) (child, bool, error) {
+	var found child
+	for _, boxType := range path {
+		boxes, err := children(content, start, end)
+		if nil != err {
+			return child{}, false, err
+		}
+		exist := false
+		for _, c := range boxes {
+			if boxType == c.Type {
+				found, exist = c, true
+				break
+			}
+		}
+		if !exist {
+			return child{}, false, nil
+		}
+		start, end = found.PayloadStart, found.End
+	}
+	return found, true, nil
+}
+
+// makeBox - Returns a box of type boxType holding payload
+func makeBox(boxType string, payload ...[]byte) []byte {
+	size := boxHeaderSize
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := make([]byte, boxHeaderSize, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:8], boxType)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
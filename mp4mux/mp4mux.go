@@ -0,0 +1,493 @@
+// Package mp4mux combines fragmented MP4 files of a single track each, such as the video and audio
+// representations of a DASH manifest, into one playable fragmented MP4. Media data is copied as
+// is, only the `moov` and `moof` boxes are rewritten, so no ffmpeg is needed
+package mp4mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ReadAtSeeker is an input of Mux, such as *os.File or *bytes.Reader
+type ReadAtSeeker interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// input is a fragmented MP4 holding a single track
+type input struct {
+	r         io.ReaderAt
+	ftyp      []byte
+	moov      []byte
+	trak      []byte
+	trex      []byte
+	timescale uint32
+	fragments []fragment
+}
+
+// fragment is a `moof` box and the boxes following it up to its last `mdat`
+type fragment struct {
+	input *input
+	// track is the index of the input, the track ID in the output is track+1
+	track int
+	moof  boxInfo
+	// boxes are copied as is, boxes such as `emsg` or `free` between the `moof` and its `mdat`
+	// included: the data offsets of the `moof` count them
+	boxes []boxInfo
+	// time is the decode time of the first sample, duration the one of every sample, in seconds
+	time     float64
+	duration float64
+}
+
+// Mux - Write to w a fragmented MP4 holding the track of every input, numbered in the given order.
+// Each input must be a fragmented MP4 holding a single track; fragments are interleaved by time
+func Mux(w io.Writer, inputs ...ReadAtSeeker) error {
+	if 0 == len(inputs) {
+		return errors.New("No input to mux")
+	}
+	parsed := make([]*input, 0, len(inputs))
+	var fragments []fragment
+	for i, r := range inputs {
+		in, err := parseInput(r, i)
+		if nil != err {
+			return errors.Wrapf(err, "Error parsing input [%d]", i)
+		}
+		parsed = append(parsed, in)
+		fragments = append(fragments, in.fragments...)
+	}
+	sort.SliceStable(fragments, func(i, j int) bool {
+		return fragments[i].time < fragments[j].time
+	})
+
+	moov, err := buildMoov(parsed)
+	if nil != err {
+		return err
+	}
+	written, err := writeAll(w, parsed[0].ftyp, moov)
+	if nil != err {
+		return err
+	}
+
+	for sequence, f := range fragments {
+		moof, err := loadBox(f.input.r, f.moof)
+		if nil != err {
+			return err
+		}
+		if err = patchMoof(moof, uint32(sequence+1), uint32(f.track+1), written-f.moof.Offset); nil != err {
+			return errors.Wrapf(err, "Error rewriting fragment at [%d] of input [%d]", f.moof.Offset, f.track)
+		}
+		n, err := w.Write(moof)
+		written += int64(n)
+		if nil != err {
+			return errors.Wrap(err, "Error writing fragment")
+		}
+
+		for _, box := range f.boxes {
+			copied, err := io.Copy(w, io.NewSectionReader(f.input.r, box.Offset, box.Size))
+			written += copied
+			if nil != err {
+				return errors.Wrapf(err, "Error copying box [%s] at [%d] of input [%d]", box.Type, box.Offset, f.track)
+			}
+		}
+	}
+	return nil
+}
+
+// MuxFiles - Mux the files at inputPaths into a new file at outputPath, see Mux
+func MuxFiles(outputPath string, inputPaths ...string) error {
+	inputs := make([]ReadAtSeeker, 0, len(inputPaths))
+	for _, inputPath := range inputPaths {
+		file, err := os.Open(inputPath)
+		if nil != err {
+			return errors.Wrapf(err, "Error opening track [%s]", inputPath)
+		}
+		defer file.Close()
+		inputs = append(inputs, file)
+	}
+
+	output, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	if nil != err {
+		return errors.Wrapf(err, "Error creating [%s]", outputPath)
+	}
+	if err = Mux(output, inputs...); nil != err {
+		output.Close()
+		return errors.Wrapf(err, "Error muxing into [%s]", outputPath)
+	}
+	if err = output.Sync(); nil != err {
+		output.Close()
+		return errors.Wrapf(err, "Error flushing file [%s]", outputPath)
+	}
+	return errors.Wrapf(output.Close(), "Error closing file [%s]", outputPath)
+}
+
+// parseInput - Index the boxes of the input number track
+func parseInput(r ReadAtSeeker, track int) (*input, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if nil != err {
+		return nil, errors.Wrap(err, "Error getting input size")
+	}
+	boxes, err := readBoxes(r, size)
+	if nil != err {
+		return nil, err
+	}
+
+	in := &input{r: r}
+	// pending are the boxes following the last fragment, kept if an `mdat` of the fragment follows
+	var pending []boxInfo
+	for _, box := range boxes {
+		switch box.Type {
+		case "ftyp":
+			if nil == in.ftyp {
+				if in.ftyp, err = loadBox(r, box); nil != err {
+					return nil, err
+				}
+			}
+		case "moov":
+			if in.moov, err = loadBox(r, box); nil != err {
+				return nil, err
+			}
+			if err = in.parseMoov(); nil != err {
+				return nil, err
+			}
+		case "moof":
+			if nil == in.moov {
+				return nil, errors.New("Fragment found before `moov`")
+			}
+			f := fragment{input: in, track: track, moof: box}
+			if f.time, f.duration, err = in.timing(box); nil != err {
+				return nil, err
+			}
+			in.fragments = append(in.fragments, f)
+			pending = nil
+		case "mdat":
+			if 0 == len(in.fragments) {
+				return nil, errors.New("Media data found outside of a fragment, the input is not a fragmented MP4")
+			}
+			last := &in.fragments[len(in.fragments)-1]
+			last.boxes = append(append(last.boxes, pending...), box)
+			pending = nil
+		default:
+			if len(in.fragments) > 0 {
+				pending = append(pending, box)
+			}
+		}
+		// Other boxes, such as indexes (`sidx`, `mfra`) and segment types (`styp`), refer to the
+		// input layout, they are dropped
+	}
+	if nil == in.ftyp {
+		return nil, errors.New("`ftyp` box is missing")
+	}
+	if nil == in.moov {
+		return nil, errors.New("`moov` box is missing")
+	}
+	return in, nil
+}
+
+// parseMoov - Find the single track of the input and its fragment defaults
+func (in *input) parseMoov() error {
+	boxes, err := children(in.moov, boxHeaderSize, len(in.moov))
+	if nil != err {
+		return err
+	}
+	var traks []child
+	for _, c := range boxes {
+		if "trak" == c.Type {
+			traks = append(traks, c)
+		}
+	}
+	if 1 != len(traks) {
+		return fmt.Errorf("Input holds [%d] tracks, one is expected", len(traks))
+	}
+	in.trak = append([]byte{}, in.moov[traks[0].Start:traks[0].End]...)
+
+	trex, exist, err := findChild(in.moov, boxHeaderSize, len(in.moov), "mvex", "trex")
+	if nil != err {
+		return err
+	}
+	if !exist {
+		return errors.New("`mvex` box is missing, the input is not a fragmented MP4")
+	}
+	in.trex = append([]byte{}, in.moov[trex.Start:trex.End]...)
+	if len(in.trex) < boxHeaderSize+16 {
+		return errors.New("Truncated `trex` box")
+	}
+
+	mdhd, exist, err := findChild(in.trak, boxHeaderSize, len(in.trak), "mdia", "mdhd")
+	if nil != err {
+		return err
+	}
+	if !exist {
+		return errors.New("`mdhd` box is missing")
+	}
+	timescale, err := uint32Field(in.trak, mdhd, 12, 20)
+	if nil != err {
+		return err
+	}
+	if 0 == timescale {
+		return errors.New("Track timescale is 0")
+	}
+	in.timescale = timescale
+	return nil
+}
+
+// timing - Returns the decode time and the duration of the fragment in seconds. The decode time
+// is read from the `tfdt` box, fragments without one follow the previous one
+func (in *input) timing(box boxInfo) (float64, float64, error) {
+	moof, err := loadBox(in.r, box)
+	if nil != err {
+		return 0, 0, err
+	}
+	traf, exist, err := findChild(moof, int(box.HeaderSize), len(moof), "traf")
+	if nil != err {
+		return 0, 0, err
+	}
+	if !exist {
+		return 0, 0, errors.New("`traf` box is missing")
+	}
+	duration, err := in.duration(moof, traf)
+	if nil != err {
+		return 0, 0, err
+	}
+
+	tfdt, exist, err := findChild(moof, traf.PayloadStart, traf.End, "tfdt")
+	if nil != err {
+		return 0, 0, err
+	}
+	if !exist {
+		if 0 == len(in.fragments) {
+			return 0, duration, nil
+		}
+		previous := in.fragments[len(in.fragments)-1]
+		return previous.time + previous.duration, duration, nil
+	}
+	payload := moof[tfdt.PayloadStart:tfdt.End]
+	if len(payload) < 8 {
+		return 0, 0, errors.New("Truncated `tfdt` box")
+	}
+	if 1 == payload[0] {
+		if len(payload) < 12 {
+			return 0, 0, errors.New("Truncated `tfdt` box")
+		}
+		return float64(binary.BigEndian.Uint64(payload[4:12])) / float64(in.timescale), duration, nil
+	}
+	return float64(binary.BigEndian.Uint32(payload[4:8])) / float64(in.timescale), duration, nil
+}
+
+// duration - Returns the duration of the samples of the `traf` box in seconds, from the `trun`
+// boxes, or the defaults of the `tfhd` and `trex` boxes when they give no sample duration
+func (in *input) duration(moof []byte, traf child) (float64, error) {
+	boxes, err := children(moof, traf.PayloadStart, traf.End)
+	if nil != err {
+		return 0, err
+	}
+	// default_sample_duration of the `trex` box
+	defaultDuration := binary.BigEndian.Uint32(in.trex[boxHeaderSize+12:])
+	for _, c := range boxes {
+		if "tfhd" != c.Type {
+			continue
+		}
+		tfhd := moof[c.PayloadStart:c.End]
+		if len(tfhd) < 8 {
+			return 0, errors.New("Truncated `tfhd` box")
+		}
+		flags := binary.BigEndian.Uint32(tfhd) & 0xffffff
+		// default-sample-duration-present, after the optional base data offset and description index
+		if 0 != flags&0x08 {
+			offset := 8
+			if 0 != flags&0x01 {
+				offset += 8
+			}
+			if 0 != flags&0x02 {
+				offset += 4
+			}
+			if len(tfhd) < offset+4 {
+				return 0, errors.New("Truncated `tfhd` box")
+			}
+			defaultDuration = binary.BigEndian.Uint32(tfhd[offset:])
+		}
+	}
+
+	var total uint64
+	for _, c := range boxes {
+		if "trun" != c.Type {
+			continue
+		}
+		trun := moof[c.PayloadStart:c.End]
+		if len(trun) < 8 {
+			return 0, errors.New("Truncated `trun` box")
+		}
+		flags := binary.BigEndian.Uint32(trun) & 0xffffff
+		count := uint64(binary.BigEndian.Uint32(trun[4:]))
+		// sample-duration-present, otherwise every sample lasts the default duration
+		if 0 == flags&0x100 {
+			total += count * uint64(defaultDuration)
+			continue
+		}
+		offset := 8
+		if 0 != flags&0x01 {
+			offset += 4
+		}
+		if 0 != flags&0x04 {
+			offset += 4
+		}
+		sampleSize := 4
+		for _, field := range []uint32{0x200, 0x400, 0x800} {
+			if 0 != flags&field {
+				sampleSize += 4
+			}
+		}
+		if uint64(len(trun)-offset) < count*uint64(sampleSize) {
+			return 0, errors.New("Truncated `trun` box")
+		}
+		for i := uint64(0); i < count; i++ {
+			total += uint64(binary.BigEndian.Uint32(trun[offset+int(i)*sampleSize:]))
+		}
+	}
+	return float64(total) / float64(in.timescale), nil
+}
+
+// buildMoov - Returns the `moov` of the output: the movie header and extra boxes of the first input,
+// then the tracks of every input renumbered
+func buildMoov(inputs []*input) ([]byte, error) {
+	first := inputs[0]
+	boxes, err := children(first.moov, boxHeaderSize, len(first.moov))
+	if nil != err {
+		return nil, err
+	}
+
+	var mvhd []byte
+	var others [][]byte
+	for _, c := range boxes {
+		switch c.Type {
+		case "mvhd":
+			mvhd = append([]byte{}, first.moov[c.Start:c.End]...)
+		case "trak", "mvex":
+		default:
+			others = append(others, first.moov[c.Start:c.End])
+		}
+	}
+	if nil == mvhd {
+		return nil, errors.New("`mvhd` box is missing")
+	}
+	if len(mvhd) < boxHeaderSize+4 {
+		return nil, errors.New("Truncated `mvhd` box")
+	}
+	// next_track_ID ends the movie header
+	binary.BigEndian.PutUint32(mvhd[len(mvhd)-4:], uint32(len(inputs)+1))
+
+	payload := [][]byte{mvhd}
+	var trexes [][]byte
+	for i, in := range inputs {
+		trak := append([]byte{}, in.trak...)
+		tkhd, exist, err := findChild(trak, boxHeaderSize, len(trak), "tkhd")
+		if nil != err {
+			return nil, err
+		}
+		if !exist {
+			return nil, fmt.Errorf("`tkhd` box is missing in input [%d]", i)
+		}
+		if err = setUint32Field(trak, tkhd, 12, 20, uint32(i+1)); nil != err {
+			return nil, err
+		}
+		payload = append(payload, trak)
+
+		trex := append([]byte{}, in.trex...)
+		if len(trex) < boxHeaderSize+8 {
+			return nil, fmt.Errorf("Truncated `trex` box in input [%d]", i)
+		}
+		binary.BigEndian.PutUint32(trex[boxHeaderSize+4:], uint32(i+1))
+		trexes = append(trexes, trex)
+	}
+	payload = append(payload, makeBox("mvex", trexes...))
+	payload = append(payload, others...)
+	return makeBox("moov", payload...), nil
+}
+
+// patchMoof - Rewrite in place the sequence number and the track ID of a `moof` box. Absolute data
+// offsets are moved by shift, the distance between the input and output positions of the box
+func patchMoof(moof []byte, sequence uint32, trackID uint32, shift int64) error {
+	boxes, err := children(moof, boxHeaderSize, len(moof))
+	if nil != err {
+		return err
+	}
+	for _, c := range boxes {
+		switch c.Type {
+		case "mfhd":
+			if c.End-c.PayloadStart < 8 {
+				return errors.New("Truncated `mfhd` box")
+			}
+			binary.BigEndian.PutUint32(moof[c.PayloadStart+4:], sequence)
+		case "traf":
+			tfhd, exist, err := findChild(moof, c.PayloadStart, c.End, "tfhd")
+			if nil != err {
+				return err
+			}
+			if !exist || tfhd.End-tfhd.PayloadStart < 8 {
+				return errors.New("`tfhd` box is missing or truncated")
+			}
+			binary.BigEndian.PutUint32(moof[tfhd.PayloadStart+4:], trackID)
+
+			// base-data-offset-present
+			if 0 != moof[tfhd.PayloadStart+3]&0x01 {
+				if tfhd.End-tfhd.PayloadStart < 16 {
+					return errors.New("Truncated `tfhd` box")
+				}
+				offset := moof[tfhd.PayloadStart+8 : tfhd.PayloadStart+16]
+				binary.BigEndian.PutUint64(offset, uint64(int64(binary.BigEndian.Uint64(offset))+shift))
+			}
+		}
+	}
+	return nil
+}
+
+// uint32Field - Read the 32 bits field of a full box at offset0 in its payload for version 0
+// boxes, offset1 for version 1 ones
+func uint32Field(content []byte, c child, offset0 int, offset1 int) (uint32, error) {
+	offset, err := versionedOffset(content, c, offset0, offset1)
+	if nil != err {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(content[offset:]), nil
+}
+
+// setUint32Field - Write the 32 bits field of a full box, see uint32Field
+func setUint32Field(content []byte, c child, offset0 int, offset1 int, value uint32) error {
+	offset, err := versionedOffset(content, c, offset0, offset1)
+	if nil != err {
+		return err
+	}
+	binary.BigEndian.PutUint32(content[offset:], value)
+	return nil
+}
+
+func versionedOffset(content []byte, c child, offset0 int, offset1 int) (int, error) {
+	if c.End-c.PayloadStart < 1 {
+		return 0, fmt.Errorf("Truncated `%s` box", c.Type)
+	}
+	offset := c.PayloadStart + offset0
+	if 1 == content[c.PayloadStart] {
+		offset = c.PayloadStart + offset1
+	}
+	if offset+4 > c.End {
+		return 0, fmt.Errorf("Truncated `%s` box", c.Type)
+	}
+	return offset, nil
+}
+
+// writeAll - Write every chunk to w, returns the amount of bytes written
+func writeAll(w io.Writer, chunks ...[]byte) (int64, error) {
+	var written int64
+	for _, chunk := range chunks {
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if nil != err {
+			return written, errors.Wrap(err, "Error writing header")
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,167 @@
+package mp4mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"video-downloader/internal/mp4muxtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// muxedFragment is what a test reads back from a muxed fragment
+type muxedFragment struct {
+	Sequence uint32
+	TrackID  uint32
+	Sample   string
+}
+
+// readMuxed - Returns the track IDs of the `moov` box and the fragments of content
+func readMuxed(t *testing.T, content []byte) ([]uint32, []muxedFragment) {
+	boxes, err := children(content, 0, len(content))
+	assert.Nil(t, err)
+
+	var trackIDs []uint32
+	var fragments []muxedFragment
+	for i, box := range boxes {
+		switch box.Type {
+		case "moov":
+			moovBoxes, err := children(content, box.PayloadStart, box.End)
+			assert.Nil(t, err)
+			for _, c := range moovBoxes {
+				if "trak" == c.Type {
+					tkhd, _, _ := findChild(content, c.PayloadStart, c.End, "tkhd")
+					trackIDs = append(trackIDs, binary.BigEndian.Uint32(content[tkhd.PayloadStart+12:]))
+				}
+			}
+			mvhd, _, _ := findChild(content, box.PayloadStart, box.End, "mvhd")
+			assert.Equal(t, uint32(len(trackIDs)+1), binary.BigEndian.Uint32(content[mvhd.End-4:]))
+		case "moof":
+			mfhd, _, _ := findChild(content, box.PayloadStart, box.End, "mfhd")
+			tfhd, _, _ := findChild(content, box.PayloadStart, box.End, "traf", "tfhd")
+			// The sample is at the absolute base data offset, or at the `trun` offset from the `moof`
+			var offset int
+			if 0 != content[tfhd.PayloadStart+3]&0x01 {
+				offset = int(binary.BigEndian.Uint64(content[tfhd.PayloadStart+8:]))
+			} else {
+				trun, _, _ := findChild(content, box.PayloadStart, box.End, "traf", "trun")
+				offset = box.Start + int(binary.BigEndian.Uint32(content[trun.PayloadStart+8:]))
+			}
+			var mdat child
+			for _, next := range boxes[i+1:] {
+				if "mdat" == next.Type {
+					mdat = next
+					break
+				}
+			}
+			assert.Equal(t, mdat.PayloadStart, offset)
+			fragments = append(fragments, muxedFragment{
+				Sequence: binary.BigEndian.Uint32(content[mfhd.PayloadStart+4:]),
+				TrackID:  binary.BigEndian.Uint32(content[tfhd.PayloadStart+4:]),
+				Sample:   string(content[offset:mdat.End]),
+			})
+		case "ftyp", "mdat", "emsg", "free":
+		default:
+			t.Errorf("Unexpected box [%s] in muxed file", box.Type)
+		}
+	}
+	return trackIDs, fragments
+}
+
+func TestMux(t *testing.T) {
+	// Both tracks are numbered 1, the audio timescale differs from the video one
+	video := mp4muxtest.FragmentedMP4(1, "vide", 90000, []uint64{0, 180000, 360000}, []string{"v0", "v1", "v2"})
+	audio := mp4muxtest.FragmentedMP4(1, "soun", 48000, []uint64{0, 48000, 96000, 144000}, []string{"a0", "a1", "a2", "a3"})
+
+	var output bytes.Buffer
+	err := Mux(&output, bytes.NewReader(video), bytes.NewReader(audio))
+	assert.Nil(t, err)
+
+	trackIDs, fragments := readMuxed(t, output.Bytes())
+	assert.Equal(t, []uint32{1, 2}, trackIDs)
+	assert.Equal(t, []muxedFragment{
+		{1, 1, "v0"},
+		{2, 2, "a0"},
+		{3, 2, "a1"},
+		{4, 1, "v1"},
+		{5, 2, "a2"},
+		{6, 2, "a3"},
+		{7, 1, "v2"},
+	}, fragments)
+}
+
+func TestMuxFragmentLayouts(t *testing.T) {
+	time := func(value uint64) *uint64 { return &value }
+	emsg := mp4muxtest.MakeBox("emsg", []byte("event message"))
+	// The video fragments carry an `emsg` between their `moof` and `mdat`
+	video := mp4muxtest.FragmentedMP4Of(1, "vide", 1000, []mp4muxtest.Fragment{
+		{Time: time(0), Duration: 2000, Between: [][]byte{emsg}, Sample: "v0"},
+		{Time: time(2000), Duration: 2000, Between: [][]byte{emsg, mp4muxtest.MakeBox("free")}, Sample: "v1"},
+	})
+	// The audio fragments after the first have no `tfdt`, they follow the previous one
+	audio := mp4muxtest.FragmentedMP4Of(1, "soun", 1000, []mp4muxtest.Fragment{
+		{Time: time(0), Duration: 1500, Sample: "a0"},
+		{Duration: 1500, Sample: "a1"},
+		{Duration: 1500, Sample: "a2"},
+	})
+
+	var output bytes.Buffer
+	assert.Nil(t, Mux(&output, bytes.NewReader(video), bytes.NewReader(audio)))
+	trackIDs, fragments := readMuxed(t, output.Bytes())
+	assert.Equal(t, []uint32{1, 2}, trackIDs)
+	assert.Equal(t, []muxedFragment{
+		{1, 1, "v0"},
+		{2, 2, "a0"},
+		{3, 2, "a1"},
+		{4, 1, "v1"},
+		{5, 2, "a2"},
+	}, fragments)
+	assert.Equal(t, 2, bytes.Count(output.Bytes(), emsg))
+}
+
+func TestMuxInvalidInputs(t *testing.T) {
+	video := mp4muxtest.FragmentedMP4(1, "vide", 90000, []uint64{0}, []string{"v0"})
+	var output bytes.Buffer
+
+	err := Mux(&output)
+	assert.EqualError(t, err, "No input to mux")
+
+	// A progressive MP4 has no `mvex`
+	progressive := append(makeBox("ftyp", []byte("isom"), mp4muxtest.Uint32Bytes(0)), makeBox("moov", makeBox("mvhd", make([]byte, 100)), makeBox("trak"))...)
+	err = Mux(&output, bytes.NewReader(video), bytes.NewReader(progressive))
+	assert.EqualError(t, err, "Error parsing input [1]: `mvex` box is missing, the input is not a fragmented MP4")
+
+	twoTracks := append(makeBox("ftyp", []byte("isom"), mp4muxtest.Uint32Bytes(0)), makeBox("moov", makeBox("trak"), makeBox("trak"))...)
+	err = Mux(&output, bytes.NewReader(twoTracks))
+	assert.EqualError(t, err, "Error parsing input [0]: Input holds [2] tracks, one is expected")
+
+	err = Mux(&output, bytes.NewReader([]byte("not a mp4 file")))
+	assert.EqualError(t, err, "Error parsing input [0]: Invalid size [1852797984] of box [a mp] at [0]")
+}
+
+func TestMuxFiles(t *testing.T) {
+	directory, err := ioutil.TempDir("", "mp4mux")
+	if nil != err {
+		t.Fatalf("Could not create temporary path, reason: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	videoPath := filepath.Join(directory, "video.mp4")
+	audioPath := filepath.Join(directory, "audio.m4a")
+	outputPath := filepath.Join(directory, "muxed.mp4")
+	ioutil.WriteFile(videoPath, mp4muxtest.FragmentedMP4(1, "vide", 1000, []uint64{0, 2000}, []string{"v0", "v1"}), 0644)
+	ioutil.WriteFile(audioPath, mp4muxtest.FragmentedMP4(1, "soun", 1000, []uint64{0, 2000}, []string{"a0", "a1"}), 0644)
+
+	err = MuxFiles(outputPath, videoPath, audioPath)
+	assert.Nil(t, err)
+	content, _ := ioutil.ReadFile(outputPath)
+	trackIDs, fragments := readMuxed(t, content)
+	assert.Equal(t, []uint32{1, 2}, trackIDs)
+	assert.Equal(t, []muxedFragment{{1, 1, "v0"}, {2, 2, "a0"}, {3, 1, "v1"}, {4, 2, "a1"}}, fragments)
+
+	err = MuxFiles(outputPath, videoPath, filepath.Join(directory, "missing.m4a"))
+	assert.Contains(t, err.Error(), "Error opening track")
+}
@@ -0,0 +1,177 @@
+package direct
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"video-downloader/downloader"
+	"video-downloader/parsingelement"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Name is the site name of the extractor
+const Name = "direct"
+
+// mediaExtensions are the extensions of the URLs pointing at a media file or a stream manifest
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".webm": true, ".mkv": true, ".mov": true,
+	".avi": true, ".flv": true, ".wmv": true, ".ogv": true, ".3gp": true, ".ts": true, ".m3u8": true, ".mpd": true,
+}
+
+// Direct handles URLs pointing at a media file rather than at a page. It can be used concurrently
+// by many goroutines
+type Direct struct {
+	// Extensions replaces the URL extensions considered as media files when set
+	Extensions []string `mapstructure:"extensions"`
+
+	parsingelement.Dependencies `mapstructure:"-"`
+}
+
+func init() {
+	parsingelement.Register(Name, func() parsingelement.Extractor { return &Direct{} })
+}
+
+// Name - Returns the name of the site, implements parsingelement.Extractor
+func (d *Direct) Name() string {
+	return Name
+}
+
+// Match - Check the path of url ends with a media extension, implements parsingelement.Extractor
+func (d *Direct) Match(url string) bool {
+	return d.isMediaExtension(urlExtension(url))
+}
+
+// Extract - Returns the informations of the media file at url, read from the headers the server
+// answers, implements parsingelement.Extractor
+func (d *Direct) Extract(ctx context.Context, url string) (*downloader.VideoInfos, error) {
+	header, err := d.fetchHeader(ctx, url)
+	if nil != err {
+		return nil, err
+	}
+
+	vi := &downloader.VideoInfos{URL: url}
+	if vi.Extension, err = d.extension(url, header.Get("Content-Type")); nil != err {
+		return nil, err
+	}
+	vi.ID = strings.TrimSuffix(urlFilename(url), path.Ext(urlFilename(url)))
+	vi.Title = vi.ID
+	if filename := dispositionFilename(header.Get("Content-Disposition")); "" != filename {
+		vi.Title = strings.TrimSuffix(filename, path.Ext(filename))
+	}
+	logrus.Debugf("Parsed video information, obtained %v", vi)
+	return vi, nil
+}
+
+// fetchHeader - Returns the headers served with the media. Servers refusing HEAD are asked for
+// the first byte only
+func (d *Direct) fetchHeader(ctx context.Context, url string) (http.Header, error) {
+	header, err := d.request(ctx, http.MethodHead, url)
+	if nil == err {
+		return header, nil
+	}
+	logrus.Debugf("HEAD request failed on [%s], fall back to a ranged GET, reason: %v", url, err)
+	return d.request(ctx, http.MethodGet, url)
+}
+
+// request - Send a request with the retry policy and returns the headers of the answer. GET
+// requests ask for the first byte only, the body is not read
+func (d *Direct) request(ctx context.Context, method string, url string) (http.Header, error) {
+	var header http.Header
+	err := d.Retry.DoContext(ctx, fmt.Sprintf("requesting %s [%s]", method, url), func() error {
+		req, err := http.NewRequest(method, url, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating %s request for [%s]", method, url)
+		}
+		if http.MethodGet == method {
+			req.Header.Set("Range", "bytes=0-0")
+		}
+		resp, err := parsingelement.HTTPClient(d.Client).Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error requesting %s [%s]", method, url)
+		}
+		resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+		header = resp.Header
+		return nil
+	})
+	return header, err
+}
+
+// extension - Returns the extension from the served content type, from the URL when the type is
+// missing or only tells the file is binary. Documents such as error pages are refused
+func (d *Direct) extension(url string, contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "/xml") {
+		return "", fmt.Errorf("URL [%s] serves [%s] rather than a media file", url, contentType)
+	}
+	if "" != contentType && "application/octet-stream" != mediaType && "binary/octet-stream" != mediaType {
+		extension, err := downloader.ExtensionFromType(contentType)
+		if nil == err {
+			return extension, nil
+		}
+		logrus.Debugf("Unknown content type [%s] for [%s], use the URL extension, reason: %v", contentType, url, err)
+	}
+	if extension := urlExtension(url); d.isMediaExtension(extension) {
+		return extension, nil
+	}
+	return "", fmt.Errorf("No extension found for [%s] served as [%s]", url, contentType)
+}
+
+// isMediaExtension - Check extension is one of the configured media extensions
+func (d *Direct) isMediaExtension(extension string) bool {
+	if "" == extension {
+		return false
+	}
+	if 0 == len(d.Extensions) {
+		return mediaExtensions[extension]
+	}
+	for _, configured := range d.Extensions {
+		if !strings.HasPrefix(configured, ".") {
+			configured = "." + configured
+		}
+		if strings.EqualFold(configured, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlFilename - Returns the last element of the URL path, unescaped
+func urlFilename(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if nil != err {
+		return ""
+	}
+	filename := path.Base(parsed.Path)
+	if "/" == filename || "." == filename {
+		return ""
+	}
+	return filename
+}
+
+// urlExtension - Returns the lowered extension of the URL path
+func urlExtension(rawURL string) string {
+	return strings.ToLower(path.Ext(urlFilename(rawURL)))
+}
+
+// dispositionFilename - Returns the filename given by a `Content-Disposition` header, RFC 2231
+// encoded names included
+func dispositionFilename(disposition string) string {
+	if "" == disposition {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(disposition)
+	if nil != err || "" == params["filename"] {
+		return ""
+	}
+	return path.Base(strings.Replace(params["filename"], `\`, "/", -1))
+}
@@ -0,0 +1,99 @@
+package direct
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	d := &Direct{}
+	assert.True(t, d.Match("https://cdn.test/videos/Lesson%201.MP4?token=abc"))
+	assert.True(t, d.Match("http://cdn.test/a.mkv"))
+	assert.False(t, d.Match("https://cdn.test/watch?v=a.mp4"))
+	assert.False(t, d.Match("https://cdn.test/"))
+
+	d.Extensions = []string{"mpg", ".MP4"}
+	assert.True(t, d.Match("https://cdn.test/a.mpg"))
+	assert.True(t, d.Match("https://cdn.test/a.mp4"))
+	assert.False(t, d.Match("https://cdn.test/a.webm"))
+}
+
+func TestExtract(t *testing.T) {
+	var headRequests, getRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodHead == r.Method {
+			headRequests++
+		} else {
+			getRequests++
+		}
+		switch r.URL.Path {
+		case "/files/intro.mp4":
+			w.Header().Set("Content-Type", "video/webm")
+			w.Header().Set("Content-Disposition", `attachment; filename*=UTF-8''Caf%C3%A9%20tour.webm`)
+		case "/files/nohead.mkv":
+			if http.MethodHead == r.Method {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			assert.Equal(t, "bytes=0-0", r.Header.Get("Range"))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "x")
+		case "/files/page.html":
+			w.Header().Set("Content-Type", "text/html")
+		case "/files/unknown.mov":
+			w.Header().Set("Content-Type", "video/x-unknown")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	d := &Direct{}
+	vi, err := d.Extract(context.Background(), server.URL+"/files/intro.mp4")
+	assert.Nil(t, err)
+	assert.Equal(t, &downloader.VideoInfos{URL: server.URL + "/files/intro.mp4", Extension: ".webm", Title: "Café tour", ID: "intro"}, vi)
+	assert.Equal(t, 1, headRequests)
+	assert.Equal(t, 0, getRequests)
+
+	vi, err = d.Extract(context.Background(), server.URL+"/files/nohead.mkv")
+	assert.Nil(t, err)
+	assert.Equal(t, &downloader.VideoInfos{URL: server.URL + "/files/nohead.mkv", Extension: ".mkv", Title: "nohead", ID: "nohead"}, vi)
+	assert.Equal(t, 1, getRequests)
+
+	vi, err = d.Extract(context.Background(), server.URL+"/files/page.html")
+	assert.Nil(t, vi)
+	assert.EqualError(t, err, fmt.Sprintf("URL [%s/files/page.html] serves [text/html] rather than a media file", server.URL))
+
+	vi, err = d.Extract(context.Background(), server.URL+"/files/unknown.mov")
+	assert.Nil(t, err)
+	assert.Equal(t, ".mov", vi.Extension)
+
+	d.Extensions = []string{".mp4"}
+	vi, err = d.Extract(context.Background(), server.URL+"/files/unknown.mov")
+	assert.Nil(t, vi)
+	assert.EqualError(t, err, fmt.Sprintf("No extension found for [%s/files/unknown.mov] served as [video/x-unknown]", server.URL))
+
+	vi, err = d.Extract(context.Background(), server.URL+"/files/missing.mp4")
+	assert.Nil(t, vi)
+	assert.EqualError(t, err, fmt.Sprintf("Server answered [404 Not Found] for [%s/files/missing.mp4]", server.URL))
+}
+
+func TestDispositionFilename(t *testing.T) {
+	cases := map[string]string{
+		"":                                      "",
+		"inline":                                "",
+		`attachment; filename="a b.mp4"`:        "a b.mp4",
+		`attachment; filename="..\..\evil.mp4"`: "evil.mp4",
+		"attachment; filename=":                 "",
+	}
+	for disposition, expected := range cases {
+		assert.Equal(t, expected, dispositionFilename(disposition), disposition)
+	}
+}
@@ -0,0 +1,376 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"video-downloader/downloader"
+	"video-downloader/parsingelement"
+	"video-downloader/retry"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Name is the site name of the extractor
+const Name = "generic"
+
+// defaultMaxPageSize bounds the amount of HTML read from a page when none is configured
+const defaultMaxPageSize = 5 * 1024 * 1024
+
+var (
+	tagRegexp       = regexp.MustCompile(`(?is)<(video|source|meta)\b((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	attributeRegexp = regexp.MustCompile(`(?s)([a-zA-Z_:.-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	titleRegexp     = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	jsonLDRegexp    = regexp.MustCompile(`(?is)<script\b[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+)
+
+// Generic finds the videos embedded in any web page: `<video>` and `<source>` tags, `og:video`
+// and `twitter:player:stream` meta tags, and schema.org `VideoObject` JSON-LD.
+// It can be used concurrently by many goroutines
+type Generic struct {
+	// MaxPageSize is the maximum amount of bytes read from a page, 5MiB when not set
+	MaxPageSize int64 `mapstructure:"max_page_size"`
+
+	parsingelement.Dependencies `mapstructure:"-"`
+}
+
+func init() {
+	parsingelement.Register(Name, func() parsingelement.Extractor { return &Generic{} })
+}
+
+// Name - Returns the name of the site, implements parsingelement.Extractor
+func (g *Generic) Name() string {
+	return Name
+}
+
+// Match - Check url is a web page, implements parsingelement.Extractor
+func (g *Generic) Match(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Fallback - Implements parsingelement.Fallback, dedicated extractors are tried first
+func (g *Generic) Fallback() {}
+
+// Extract - Returns the informations of the first video embedded in the page at url, implements
+// parsingelement.Extractor
+func (g *Generic) Extract(ctx context.Context, url string) (*downloader.VideoInfos, error) {
+	page, pageURL, err := g.fetchPage(ctx, url)
+	if nil != err {
+		return nil, err
+	}
+	vi, err := parsePage(page, pageURL)
+	if nil != err {
+		return nil, errors.Wrapf(err, "Run `parsePage` error on url [%s]", url)
+	}
+	logrus.Debugf("Parsed video information, obtained %v", vi)
+	return vi, nil
+}
+
+// fetchPage - Returns the HTML of the page and its URL once redirections are followed
+func (g *Generic) fetchPage(ctx context.Context, pageURL string) (string, *url.URL, error) {
+	maxPageSize := g.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = defaultMaxPageSize
+	}
+
+	var content []byte
+	var finalURL *url.URL
+	err := g.Retry.DoContext(ctx, fmt.Sprintf("fetching page [%s]", pageURL), func() error {
+		req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating request for page [%s]", pageURL)
+		}
+		resp, err := parsingelement.HTTPClient(g.Client).Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error fetching page [%s]", pageURL)
+		}
+		defer resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+
+		if content, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize)); nil != err {
+			return errors.Wrapf(err, "Error reading page [%s]", pageURL)
+		}
+		finalURL = resp.Request.URL
+		return nil
+	})
+	if nil != err {
+		return "", nil, err
+	}
+	return string(content), finalURL, nil
+}
+
+// candidate is a video source found in a page
+type candidate struct {
+	url       string
+	mediaType string
+}
+
+// parsePage - Build the video informations from the HTML of a page. Sources are taken in order from
+// `<video>`/`<source>` tags, JSON-LD, `og:video` then `twitter:player:stream`
+func parsePage(page string, pageURL *url.URL) (*downloader.VideoInfos, error) {
+	var tags, jsonLD, openGraph, twitter []candidate
+	meta := map[string]string{}
+	var ogType string
+
+	for _, match := range tagRegexp.FindAllStringSubmatch(page, -1) {
+		attributes := parseAttributes(match[2])
+		switch strings.ToLower(match[1]) {
+		case "video", "source":
+			if "" != attributes["src"] {
+				tags = append(tags, candidate{url: attributes["src"], mediaType: attributes["type"]})
+			}
+		case "meta":
+			key := attributes["property"]
+			if "" == key {
+				key = attributes["name"]
+			}
+			key = strings.ToLower(key)
+			value := attributes["content"]
+			switch key {
+			case "og:video", "og:video:url", "og:video:secure_url":
+				openGraph = append(openGraph, candidate{url: value})
+			case "og:video:type":
+				ogType = value
+			case "twitter:player:stream":
+				twitter = append(twitter, candidate{url: value})
+			case "twitter:player:stream:content_type":
+				for i := range twitter {
+					twitter[i].mediaType = value
+				}
+			}
+			if _, exist := meta[key]; !exist && "" != value {
+				meta[key] = value
+			}
+		}
+	}
+	for i := range openGraph {
+		openGraph[i].mediaType = ogType
+	}
+
+	vi := &downloader.VideoInfos{}
+	for _, match := range jsonLDRegexp.FindAllStringSubmatch(page, -1) {
+		for _, object := range findVideoObjects([]byte(strings.TrimSpace(match[1]))) {
+			if "" != object.ContentURL {
+				jsonLD = append(jsonLD, candidate{url: object.ContentURL, mediaType: object.EncodingFormat})
+			}
+			if "" == vi.Title {
+				vi.Title = object.Name
+			}
+			if "" == vi.Uploader {
+				vi.Uploader = object.author()
+			}
+			if "" == vi.Date {
+				vi.Date = formatDate(object.UploadDate)
+			}
+		}
+	}
+
+	var candidates []candidate
+	for _, found := range [][]candidate{tags, jsonLD, openGraph, twitter} {
+		candidates = append(candidates, found...)
+	}
+	var chosen *candidate
+	for i := range candidates {
+		resolved, err := resolveURL(pageURL, candidates[i].url)
+		if nil != err {
+			logrus.Debugf("Ignore video source [%s], reason: %v", candidates[i].url, err)
+			continue
+		}
+		candidates[i].url = resolved
+		chosen = &candidates[i]
+		break
+	}
+	if nil == chosen {
+		return nil, errors.New("No video found in page")
+	}
+
+	vi.URL = chosen.url
+	var err error
+	if vi.Extension, err = extension(*chosen); nil != err {
+		return nil, err
+	}
+	if "" == vi.Title {
+		vi.Title = firstNotEmpty(meta["og:title"], meta["twitter:title"], pageTitle(page))
+	}
+	if "" == vi.Uploader {
+		vi.Uploader = meta["author"]
+	}
+	vi.ID = strings.TrimSuffix(path.Base(pageURL.Path), path.Ext(pageURL.Path))
+	if "/" == vi.ID || "." == vi.ID {
+		vi.ID = pageURL.Hostname()
+	}
+	return vi, nil
+}
+
+// parseAttributes - Returns the attributes of a tag, names lowered and values unescaped
+func parseAttributes(tag string) map[string]string {
+	attributes := map[string]string{}
+	for _, match := range attributeRegexp.FindAllStringSubmatch(tag, -1) {
+		name := strings.ToLower(match[1])
+		if _, exist := attributes[name]; exist {
+			continue
+		}
+		value := strings.Trim(match[2], `"'`)
+		attributes[name] = strings.TrimSpace(html.UnescapeString(value))
+	}
+	return attributes
+}
+
+// pageTitle - Returns the content of the `<title>` tag
+func pageTitle(page string) string {
+	match := titleRegexp.FindStringSubmatch(page)
+	if nil == match {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(match[1])), " ")
+}
+
+// resolveURL - Returns the absolute URL of a source found in the page
+func resolveURL(pageURL *url.URL, source string) (string, error) {
+	if "" == source {
+		return "", errors.New("Empty source")
+	}
+	ref, err := url.Parse(source)
+	if nil != err {
+		return "", err
+	}
+	resolved := pageURL.ResolveReference(ref)
+	if "http" != resolved.Scheme && "https" != resolved.Scheme {
+		return "", fmt.Errorf("Unsupported scheme [%s]", resolved.Scheme)
+	}
+	return resolved.String(), nil
+}
+
+// extension - Returns the extension of the video, from the announced type first then the URL path
+// whose extension may be the one of a script. Stream manifests keep their extension whatever the
+// announced type, it tells how they are downloaded
+func extension(c candidate) (string, error) {
+	var pathExtension string
+	if parsed, err := url.Parse(c.url); nil == err {
+		if ext := strings.ToLower(path.Ext(parsed.Path)); len(ext) <= 6 {
+			pathExtension = ext
+		}
+	}
+	if ".m3u8" == pathExtension || ".mpd" == pathExtension {
+		return pathExtension, nil
+	}
+	if "" != c.mediaType {
+		if ext, err := downloader.ExtensionFromType(c.mediaType); nil == err {
+			return ext, nil
+		}
+	}
+	if "" != pathExtension {
+		return pathExtension, nil
+	}
+	return "", fmt.Errorf("No extension found for video [%s]", c.url)
+}
+
+// formatDate - Convert an ISO 8601 date to YYYYMMDD, empty when it can't be parsed
+func formatDate(value string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if date, err := time.Parse(layout, value); nil == err {
+			return date.Format("20060102")
+		}
+	}
+	if len(value) >= 10 {
+		if date, err := time.Parse("2006-01-02", value[:10]); nil == err {
+			return date.Format("20060102")
+		}
+	}
+	return ""
+}
+
+func firstNotEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); "" != value {
+			return value
+		}
+	}
+	return ""
+}
+
+// videoObject holds the fields of a schema.org VideoObject used to describe a video
+type videoObject struct {
+	Type           json.RawMessage   `json:"@type"`
+	Name           string            `json:"name"`
+	ContentURL     string            `json:"contentUrl"`
+	EncodingFormat string            `json:"encodingFormat"`
+	UploadDate     string            `json:"uploadDate"`
+	Author         json.RawMessage   `json:"author"`
+	Graph          []json.RawMessage `json:"@graph"`
+}
+
+// isVideo - Check the object is typed VideoObject, `@type` being a string or a list
+func (vo *videoObject) isVideo() bool {
+	var single string
+	if nil == json.Unmarshal(vo.Type, &single) {
+		return "VideoObject" == single
+	}
+	var many []string
+	if nil == json.Unmarshal(vo.Type, &many) {
+		for _, t := range many {
+			if "VideoObject" == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// author - Returns the name of the author, given as a string, a Person or a list of them
+func (vo *videoObject) author() string {
+	var name string
+	if nil == json.Unmarshal(vo.Author, &name) {
+		return name
+	}
+	var person struct {
+		Name string `json:"name"`
+	}
+	if nil == json.Unmarshal(vo.Author, &person) {
+		return person.Name
+	}
+	var people []struct {
+		Name string `json:"name"`
+	}
+	if nil == json.Unmarshal(vo.Author, &people) && len(people) > 0 {
+		return people[0].Name
+	}
+	return ""
+}
+
+// findVideoObjects - Returns the VideoObjects of a JSON-LD document, an object, a list or a graph
+func findVideoObjects(document []byte) []videoObject {
+	var objects []json.RawMessage
+	if err := json.Unmarshal(document, &objects); nil != err {
+		objects = []json.RawMessage{document}
+	}
+
+	var videos []videoObject
+	for _, raw := range objects {
+		var object videoObject
+		if err := json.Unmarshal(raw, &object); nil != err {
+			logrus.Debugf("Ignore invalid JSON-LD, reason: %v", err)
+			continue
+		}
+		if object.isVideo() {
+			videos = append(videos, object)
+		}
+		for _, node := range object.Graph {
+			videos = append(videos, findVideoObjects(node)...)
+		}
+	}
+	return videos
+}
@@ -0,0 +1,114 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"video-downloader/downloader"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage(t *testing.T) {
+	pageURL, _ := url.Parse("https://training.test/courses/intro.html")
+
+	cases := map[string]struct {
+		page     string
+		expected *downloader.VideoInfos
+		err      error
+	}{
+		"video tag": {
+			page: `<html><head><title> Intro &amp; setup </title></head>
+				<body><video controls SRC="/media/intro.MP4?token=1"></video></body></html>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/media/intro.MP4?token=1", Extension: ".mp4", Title: "Intro & setup", ID: "intro"},
+		},
+		"source tag with type": {
+			page: `<video><source src='stream?id=2' type='video/webm; codecs="vp9"'></video>
+				<meta property="og:title" content="Open graph title">`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/courses/stream?id=2", Extension: ".webm", Title: "Open graph title", ID: "intro"},
+		},
+		"type wins over a script path": {
+			page:     `<video><source src="/embed/player.php?id=3" type="video/mp4"></video>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/embed/player.php?id=3", Extension: ".mp4", ID: "intro"},
+		},
+		"manifest keeps its extension": {
+			page:     `<video><source src="/live/index.m3u8" type="video/mp4"></video>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/live/index.m3u8", Extension: ".m3u8", ID: "intro"},
+		},
+		"unknown type falls back on the path": {
+			page:     `<video><source src="/files/v.mkv" type="video/unknown-kind"></video>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/files/v.mkv", Extension: ".mkv", ID: "intro"},
+		},
+		"open graph": {
+			page: `<meta property="og:video:type" content="video/mp4">
+				<meta property="og:video" content="https://cdn.test/v/42">
+				<meta name="twitter:title" content="Twitter title"><meta name="author" content="Alice">`,
+			expected: &downloader.VideoInfos{URL: "https://cdn.test/v/42", Extension: ".mp4", Title: "Twitter title", ID: "intro", Uploader: "Alice"},
+		},
+		"twitter": {
+			page:     `<meta name="twitter:player:stream" content="https://cdn.test/v/43.mkv">`,
+			expected: &downloader.VideoInfos{URL: "https://cdn.test/v/43.mkv", Extension: ".mkv", ID: "intro"},
+		},
+		"json-ld": {
+			page: `<meta property="og:video" content="https://cdn.test/player.mp4">
+				<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [
+					{"@type": "WebPage", "name": "Course"},
+					{"@type": ["VideoObject"], "name": "Lesson 1", "contentUrl": "/files/lesson1.mp4",
+					 "uploadDate": "2019-03-04T10:00:00+01:00", "author": {"@type": "Person", "name": "Bob"}}]}
+				</script>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/files/lesson1.mp4", Extension: ".mp4", Title: "Lesson 1", ID: "intro", Uploader: "Bob", Date: "20190304"},
+		},
+		"unsupported scheme skipped": {
+			page:     `<video src="blob:https://training.test/1"><source src="data:video/mp4;base64,AAAA"><source src="v.webm"></video>`,
+			expected: &downloader.VideoInfos{URL: "https://training.test/courses/v.webm", Extension: ".webm", ID: "intro"},
+		},
+		"no video": {
+			page: `<html><img src="a.png"><script type="application/ld+json">not json</script></html>`,
+			err:  errors.New("No video found in page"),
+		},
+		"no extension": {
+			page: `<video src="/stream"></video>`,
+			err:  errors.New("No extension found for video [https://training.test/stream]"),
+		},
+	}
+
+	for name, c := range cases {
+		vi, err := parsePage(c.page, pageURL)
+		assert.Equal(t, c.expected, vi, name)
+		if nil == c.err {
+			assert.Nil(t, err, name)
+		} else {
+			assert.EqualError(t, err, c.err.Error(), name)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/lessons/new", http.StatusMovedPermanently)
+		case "/lessons/new":
+			fmt.Fprint(w, `<title>New</title><video src="new.mp4"></video>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := &Generic{}
+	assert.True(t, g.Match(server.URL+"/old"))
+	assert.False(t, g.Match("ftp://training.test/v.mp4"))
+
+	vi, err := g.Extract(context.Background(), server.URL+"/old")
+	assert.Nil(t, err)
+	assert.Equal(t, &downloader.VideoInfos{URL: server.URL + "/lessons/new.mp4", Extension: ".mp4", Title: "New", ID: "new"}, vi)
+
+	vi, err = g.Extract(context.Background(), server.URL+"/missing")
+	assert.Nil(t, vi)
+	assert.EqualError(t, err, fmt.Sprintf("Server answered [404 Not Found] for [%s/missing]", server.URL))
+}
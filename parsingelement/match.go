@@ -0,0 +1,102 @@
+package parsingelement
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// URLMatcher declares the URLs an extractor handles, either by host or by regular expression.
+// It is read from the extractor configuration section
+type URLMatcher struct {
+	// Hosts are host names, `*` wildcards allowed as in `*.example.com`. A host also matches its
+	// `www.` subdomain
+	Hosts []string `mapstructure:"hosts"`
+	// URLPatterns are regular expressions matched against the whole URL
+	URLPatterns []string `mapstructure:"url_patterns"`
+}
+
+// compiledPattern is the result of compiling an URL pattern
+type compiledPattern struct {
+	re  *regexp.Regexp
+	err error
+}
+
+var (
+	patternsMutex sync.RWMutex
+	patterns      = map[string]compiledPattern{}
+)
+
+// compilePattern - Returns the regular expression of pattern. Each pattern is compiled once and
+// shared by every matcher, whether Validate was called or not
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternsMutex.RLock()
+	compiled, exist := patterns[pattern]
+	patternsMutex.RUnlock()
+	if !exist {
+		compiled.re, compiled.err = regexp.Compile(pattern)
+		patternsMutex.Lock()
+		patterns[pattern] = compiled
+		patternsMutex.Unlock()
+	}
+	return compiled.re, compiled.err
+}
+
+// Empty - Check no host nor pattern is declared
+func (m *URLMatcher) Empty() bool {
+	return 0 == len(m.Hosts) && 0 == len(m.URLPatterns)
+}
+
+// Validate - Check every pattern is usable
+func (m *URLMatcher) Validate() error {
+	for _, host := range m.Hosts {
+		if _, err := path.Match(strings.ToLower(host), ""); nil != err {
+			return fmt.Errorf("Invalid host pattern [%s]", host)
+		}
+	}
+	for _, pattern := range m.URLPatterns {
+		if _, err := compilePattern(pattern); nil != err {
+			return fmt.Errorf("Invalid URL pattern [%s], reason: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match - Check rawURL matches one of the hosts or URL patterns. Invalid patterns, refused by
+// Validate, never match and are reported
+func (m *URLMatcher) Match(rawURL string) bool {
+	for _, pattern := range m.URLPatterns {
+		re, err := compilePattern(pattern)
+		if nil != err {
+			logrus.Warnf("Ignore invalid URL pattern [%s], reason: %v", pattern, err)
+			continue
+		}
+		if re.MatchString(rawURL) {
+			return true
+		}
+	}
+
+	if 0 == len(m.Hosts) {
+		return false
+	}
+	parsed, err := url.Parse(rawURL)
+	if nil != err || "" == parsed.Hostname() {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, pattern := range m.Hosts {
+		pattern = strings.ToLower(pattern)
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+		if matched, _ := path.Match("www."+pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package parsingelement_test
+
+import (
+	"testing"
+	"video-downloader/parsingelement"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLMatcher(t *testing.T) {
+	matcher := parsingelement.URLMatcher{
+		Hosts:       []string{"video.test", "*.CDN.test"},
+		URLPatterns: []string{`^https?://short\.test/v/\d+$`},
+	}
+	assert.False(t, matcher.Empty())
+	assert.True(t, (&parsingelement.URLMatcher{}).Empty())
+	assert.Nil(t, matcher.Validate())
+	invalid := &parsingelement.URLMatcher{URLPatterns: []string{`^https?://short\.test/`, `(`}}
+	assert.EqualError(t, invalid.Validate(), "Invalid URL pattern [(], reason: error parsing regexp: missing closing ): `(`")
+	// The invalid pattern is ignored, the valid ones still match
+	assert.True(t, invalid.Match("https://short.test/v/42"))
+	assert.False(t, invalid.Match("https://other.test/("))
+	assert.EqualError(t, (&parsingelement.URLMatcher{Hosts: []string{"["}}).Validate(), "Invalid host pattern [[]")
+
+	cases := map[string]bool{
+		"http://video.test/watch?v=1":     true,
+		"https://www.video.test/watch":    true,
+		"https://eu.cdn.test/file.mp4":    true,
+		"https://cdn.test/file.mp4":       false,
+		"https://other.test/video.test":   false,
+		"https://short.test/v/42":         true,
+		"https://short.test/v/42/comment": false,
+		"video.test":                      false,
+		"":                                false,
+	}
+	for url, expected := range cases {
+		assert.Equal(t, expected, matcher.Match(url), url)
+	}
+
+	// Right case - patterns of a matcher built in code match without Validate
+	built := parsingelement.URLMatcher{URLPatterns: []string{`^https?://built\.test/\d+$`}}
+	assert.True(t, built.Match("https://built.test/42"))
+	assert.False(t, built.Match("https://built.test/abc"))
+}
@@ -1,26 +1,193 @@
 package parsingelement
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"video-downloader/downloader"
-	"video-downloader/parsingelement/u"
+	"video-downloader/retry"
 )
 
-// This struct contains all information parsing
+// Extractor gets the informations needed to download a video from the pages of a site.
+// Adding a site means writing a package whose init registers its Extractor
+type Extractor interface {
+	// Name of the site, as given to `--origin` and used as configuration section
+	Name() string
+	// Match tells whether the extractor handles url, it is used to detect the site of an URL
+	Match(url string) bool
+	// Extract resolves the video informations of the page at url
+	Extract(ctx context.Context, url string) (*downloader.VideoInfos, error)
+}
+
+// NewExtractorFunc builds an empty extractor, filled from its configuration section afterwards
+type NewExtractorFunc func() Extractor
+
+// Dependencies are the objects shared between every extractor. Extractors embed them to be
+// handed the configured ones
+type Dependencies struct {
+	// Retry is the policy applied to failing requests, nil never retries
+	Retry *retry.Policy
+	// Client sends the requests, bounded by the timeouts of the site. http.DefaultClient when nil
+	Client *http.Client
+}
+
+// UseDependencies - Implements DependencyUser for the extractors embedding Dependencies
+func (d *Dependencies) UseDependencies(deps Dependencies) {
+	*d = deps
+}
+
+// HTTPClient - Returns client, http.DefaultClient when nil
+func HTTPClient(client *http.Client) *http.Client {
+	if nil == client {
+		return http.DefaultClient
+	}
+	return client
+}
+
+// DependencyUser is implemented by extractors that need the shared dependencies
+type DependencyUser interface {
+	UseDependencies(deps Dependencies)
+}
+
+// Validator is implemented by extractors able to check their configuration
+type Validator interface {
+	Validate() error
+}
+
+// Fallback is implemented by generic extractors handling any URL. They are only tried when no
+// dedicated extractor matches
+type Fallback interface {
+	Fallback()
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]NewExtractorFunc{}
+)
+
+// Register makes an extractor available under name. It is meant to be called from the init
+// function of the extractor package and panics when name is already taken
+func Register(name string, newExtractor NewExtractorFunc) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	name = strings.ToLower(name)
+	if nil == newExtractor {
+		panic("parsingelement: Register extractor is nil")
+	}
+	if _, exist := registry[name]; exist {
+		panic("parsingelement: Register called twice for extractor " + name)
+	}
+	registry[name] = newExtractor
+}
+
+// Registered returns the sorted names of every registered extractor
+func Registered() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns an empty extractor registered under name
+func New(name string) (Extractor, error) {
+	registryMutex.RLock()
+	newExtractor, exist := registry[strings.ToLower(name)]
+	registryMutex.RUnlock()
+
+	if !exist {
+		return nil, fmt.Errorf("No [%s] site available", name)
+	}
+	return newExtractor(), nil
+}
+
+// This struct contains all information parsing: the configured extractors
 type ParsingInformations struct {
-	U *u.U `mapstructure:"u"`
+	extractors map[string]Extractor
+}
+
+// Add makes e available to ParseOn, replacing any extractor of the same name
+func (pi *ParsingInformations) Add(e Extractor) {
+	if nil == pi.extractors {
+		pi.extractors = map[string]Extractor{}
+	}
+	pi.extractors[strings.ToLower(e.Name())] = e
 }
 
-// ParseOn Use the right parser for the page
-func (pi *ParsingInformations) ParseOn(site string, url string) (vi *downloader.VideoInfos, err error) {
+// Extractor returns the extractor named name, if added
+func (pi *ParsingInformations) Extractor(name string) (Extractor, bool) {
+	e, exist := pi.extractors[strings.ToLower(name)]
+	return e, exist
+}
 
-	switch strings.ToLower(site) {
-	case "u":
-		vi, err = pi.U.Parse(url)
-	default:
-		err = fmt.Errorf("No [%s] site available", site)
+// UseDependencies hands deps to every extractor needing them
+func (pi *ParsingInformations) UseDependencies(deps Dependencies) {
+	for _, e := range pi.extractors {
+		if user, ok := e.(DependencyUser); ok {
+			user.UseDependencies(deps)
+		}
 	}
+}
+
+// Sites returns the sorted names of the added extractors
+func (pi *ParsingInformations) Sites() []string {
+	names := make([]string, 0, len(pi.extractors))
+	for name := range pi.extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	return
+// Detect returns the extractor handling url. Dedicated extractors are tried in name order, then
+// the fallback ones
+func (pi *ParsingInformations) Detect(url string) (Extractor, error) {
+	var fallbacks []Extractor
+	for _, name := range pi.Sites() {
+		e := pi.extractors[name]
+		if _, isFallback := e.(Fallback); isFallback {
+			fallbacks = append(fallbacks, e)
+			continue
+		}
+		if e.Match(url) {
+			return e, nil
+		}
+	}
+	for _, e := range fallbacks {
+		if e.Match(url) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("No site matches url [%s], supported sites are [%s]", url, strings.Join(pi.Sites(), ", "))
+}
+
+// ParseOn Use the right parser for the page, the one of site or the detected one when site is empty.
+// The extraction stops once ctx is done
+func (pi *ParsingInformations) ParseOn(ctx context.Context, site string, url string) (*downloader.VideoInfos, error) {
+	var e Extractor
+	if "" == site {
+		var err error
+		if e, err = pi.Detect(url); nil != err {
+			return nil, err
+		}
+	} else {
+		var exist bool
+		if e, exist = pi.Extractor(site); !exist {
+			return nil, fmt.Errorf("No [%s] site available, supported sites are [%s]", site, strings.Join(pi.Sites(), ", "))
+		}
+	}
+
+	vi, err := e.Extract(ctx, url)
+	if nil != vi && "" == vi.Site {
+		vi.Site = e.Name()
+	}
+	return vi, err
 }
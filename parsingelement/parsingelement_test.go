@@ -0,0 +1,113 @@
+package parsingelement_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"video-downloader/downloader"
+	"video-downloader/parsingelement"
+	"video-downloader/retry"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExtractor struct {
+	retry *retry.Policy
+}
+
+func (fe *fakeExtractor) Name() string { return "fake" }
+
+func (fe *fakeExtractor) Match(url string) bool { return strings.Contains(url, "fake.test") }
+
+func (fe *fakeExtractor) Extract(ctx context.Context, url string) (*downloader.VideoInfos, error) {
+	if !fe.Match(url) {
+		return nil, errors.New("Not a fake url")
+	}
+	return &downloader.VideoInfos{URL: url + "/video", Extension: ".mp4"}, nil
+}
+
+func (fe *fakeExtractor) UseDependencies(deps parsingelement.Dependencies) {
+	fe.retry = deps.Retry
+}
+
+func init() {
+	parsingelement.Register("fake", func() parsingelement.Extractor { return &fakeExtractor{} })
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Contains(t, parsingelement.Registered(), "fake")
+	assert.Panics(t, func() {
+		parsingelement.Register("Fake", func() parsingelement.Extractor { return &fakeExtractor{} })
+	})
+	assert.Panics(t, func() { parsingelement.Register("nil", nil) })
+
+	e, err := parsingelement.New("FAKE")
+	assert.Nil(t, err)
+	assert.Equal(t, &fakeExtractor{}, e)
+
+	e, err = parsingelement.New("unknown")
+	assert.Nil(t, e)
+	assert.Equal(t, errors.New("No [unknown] site available"), err)
+}
+
+func TestParseOn(t *testing.T) {
+	pi := parsingelement.ParsingInformations{}
+	vi, err := pi.ParseOn(context.Background(), "fake", "http://fake.test/1")
+	assert.Nil(t, vi)
+	assert.Equal(t, errors.New("No [fake] site available, supported sites are []"), err)
+
+	e, _ := parsingelement.New("fake")
+	pi.Add(e)
+	policy := &retry.Policy{Attempts: 2}
+	pi.UseDependencies(parsingelement.Dependencies{Retry: policy})
+	assert.Equal(t, policy, e.(*fakeExtractor).retry)
+
+	vi, err = pi.ParseOn(context.Background(), "Fake", "http://fake.test/1")
+	assert.Nil(t, err)
+	assert.Equal(t, &downloader.VideoInfos{URL: "http://fake.test/1/video", Extension: ".mp4", Site: "fake"}, vi)
+
+	vi, err = pi.ParseOn(context.Background(), "fake", "http://other.test/1")
+	assert.Nil(t, vi)
+	assert.Equal(t, errors.New("Not a fake url"), err)
+
+	// Detected from the url
+	vi, err = pi.ParseOn(context.Background(), "", "http://fake.test/2")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", vi.Site)
+	vi, err = pi.ParseOn(context.Background(), "", "http://other.test/1")
+	assert.Nil(t, vi)
+	assert.Equal(t, errors.New("No site matches url [http://other.test/1], supported sites are [fake]"), err)
+	vi, err = pi.ParseOn(context.Background(), "other", "http://fake.test/1")
+	assert.Nil(t, vi)
+	assert.Equal(t, errors.New("No [other] site available, supported sites are [fake]"), err)
+}
+
+// anyExtractor handles every URL, as generic extractors do
+type anyExtractor struct{}
+
+func (ae *anyExtractor) Name() string { return "any" }
+
+func (ae *anyExtractor) Match(url string) bool { return true }
+
+func (ae *anyExtractor) Fallback() {}
+
+func (ae *anyExtractor) Extract(ctx context.Context, url string) (*downloader.VideoInfos, error) {
+	return &downloader.VideoInfos{URL: url}, nil
+}
+
+func TestDetect(t *testing.T) {
+	pi := parsingelement.ParsingInformations{}
+	pi.Add(&anyExtractor{})
+	pi.Add(&fakeExtractor{})
+	assert.Equal(t, []string{"any", "fake"}, pi.Sites())
+
+	// The fallback extractor comes after the dedicated ones, whatever its name
+	e, err := pi.Detect("http://fake.test/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", e.Name())
+
+	e, err = pi.Detect("http://other.test/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "any", e.Name())
+}
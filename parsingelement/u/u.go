@@ -1,18 +1,25 @@
 package u
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"video-downloader/downloader"
+	"video-downloader/parsingelement"
+	"video-downloader/retry"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// Name is the site name of the extractor
+const Name = "u"
+
 // This struct contains informations to parse a specific web page in order to get video (but which one ?)
 // Those are fixed information. The structure can be access concurrently by many goroutine
 type U struct {
@@ -20,20 +27,51 @@ type U struct {
 	Delimiter       string   `mapstructure:"url_Delimiter"`
 	UidSize         int      `mapstructure:"id_number_character"`
 	QueryKeywordURL string   `mapstructure:"query_key_url"`
+	// URLMatcher declares the pages of the site, used to detect it from an URL
+	parsingelement.URLMatcher `mapstructure:",squash"`
+
+	parsingelement.Dependencies `mapstructure:"-"`
+}
+
+func init() {
+	parsingelement.Register(Name, func() parsingelement.Extractor { return &U{} })
+}
+
+// Name - Returns the name of the site, implements parsingelement.Extractor
+func (u *U) Name() string {
+	return Name
+}
+
+// Match - Check url is a page of the site holding a video ID, implements parsingelement.Extractor.
+// Without declared hosts nor URL patterns, any URL holding the delimiter matches
+func (u *U) Match(url string) bool {
+	if "" == u.Delimiter || !strings.Contains(url, u.Delimiter) {
+		return false
+	}
+	return u.URLMatcher.Empty() || u.URLMatcher.Match(url)
+}
+
+// Extract - Returns the video informations of url, implements parsingelement.Extractor
+func (u *U) Extract(ctx context.Context, url string) (*downloader.VideoInfos, error) {
+	return u.Parse(ctx, url)
 }
 
 // Parse - Parse U page to get video. Can be used concurrently
-func (u *U) Parse(url string) (*downloader.VideoInfos, error) {
+func (u *U) Parse(ctx context.Context, url string) (*downloader.VideoInfos, error) {
 	videoID, errConf := u.findVideoID(url)
 	if nil != errConf {
 		return nil, errors.Wrapf(errConf, "Run `findVideoID` error on url [%s]", url)
 	}
 	logrus.Debugf("Resolved findVideoID [%s] on url [%s]\n", videoID, url)
 
-	videoInfo, err := u.parseVideoInfo(videoID)
+	videoInfo, err := u.parseVideoInfo(ctx, videoID)
 	if nil != err {
 		return nil, errors.Wrapf(err, "Run `parseVideoInfo` error on url [%s]", url)
 	}
+	if nil == videoInfo {
+		return nil, fmt.Errorf("Run `parseVideoInfo` returned no video informations on url [%s]", url)
+	}
+	videoInfo.ID = videoID
 	logrus.Debugf("Parsed video information, obtained %v", videoInfo)
 	return videoInfo, nil
 }
@@ -60,16 +98,29 @@ func (u *U) findVideoID(url string) (string, error) {
 	return partContainingUID[:u.UidSize], nil
 }
 
-func (u *U) fetchVideoInfoURL(urlInfo string) (url.Values, error) {
-	resp, err := http.Get(urlInfo)
-	if nil != err {
-		return nil, errors.Wrapf(err, "Error fetching video infos [%s]", urlInfo)
-	}
-	defer resp.Body.Close()
-
+func (u *U) fetchVideoInfoURL(ctx context.Context, urlInfo string) (url.Values, error) {
 	var content []byte
-	if content, err = ioutil.ReadAll(resp.Body); nil != err {
-		return nil, errors.Wrapf(err, "Error reading response of video infos [%s]", urlInfo)
+	err := u.Retry.DoContext(ctx, fmt.Sprintf("fetching video infos [%s]", urlInfo), func() error {
+		req, err := http.NewRequest(http.MethodGet, urlInfo, nil)
+		if nil != err {
+			return errors.Wrapf(err, "Error creating request for video infos [%s]", urlInfo)
+		}
+		resp, err := parsingelement.HTTPClient(u.Client).Do(req.WithContext(ctx))
+		if nil != err {
+			return errors.Wrapf(err, "Error fetching video infos [%s]", urlInfo)
+		}
+		defer resp.Body.Close()
+		if err = retry.CheckStatus(resp); nil != err {
+			return err
+		}
+
+		if content, err = ioutil.ReadAll(resp.Body); nil != err {
+			return errors.Wrapf(err, "Error reading response of video infos [%s]", urlInfo)
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
 	}
 	videoFileInfoContent := string(content)
 
@@ -84,7 +135,7 @@ func (u *U) fetchVideoInfoURL(urlInfo string) (url.Values, error) {
 }
 
 // parseVideoInfo - Used to parse the information return by the forged URL that returns video information
-func (u *U) parseVideoInfo(videoID string) (*downloader.VideoInfos, error) {
+func (u *U) parseVideoInfo(ctx context.Context, videoID string) (*downloader.VideoInfos, error) {
 	var videoInfoURL string
 	var query url.Values
 	var err error
@@ -93,9 +144,12 @@ func (u *U) parseVideoInfo(videoID string) (*downloader.VideoInfos, error) {
 	var foundURL bool
 	var infosURLEncoded []string
 	for _, videoInfoURL = range u.UrlsInfos {
-		query, err = u.fetchVideoInfoURL(videoInfoURL + videoID)
+		query, err = u.fetchVideoInfoURL(ctx, videoInfoURL+videoID)
+		if nil != err {
+			return nil, err
+		}
 		if infosURLEncoded, foundURL = query[u.QueryKeywordURL]; !foundURL {
-			return nil, errors.Wrapf(err, "Error no '%s' key on query", u.QueryKeywordURL)
+			return nil, fmt.Errorf("Error no '%s' key on query", u.QueryKeywordURL)
 		}
 
 		// The url didn't worked, try next one
@@ -109,59 +163,113 @@ func (u *U) parseVideoInfo(videoID string) (*downloader.VideoInfos, error) {
 
 	// None were found, need to trigger an error
 	if nil == infosURLEncoded {
-		return nil, errors.Wrapf(err, "Error no '%s' infos on key found from video information", u.QueryKeywordURL)
+		return nil, fmt.Errorf("Error no '%s' infos on key found from video information", u.QueryKeywordURL)
 	}
 
-	infosParsed, err := url.ParseQuery(infosURLEncoded[0])
+	formats, err := parseFormats(infosURLEncoded)
 	if nil != err {
 		return nil, errors.Wrapf(err, "Error parsing '%s' from [%s]", u.QueryKeywordURL, videoInfoURL)
 	}
+	// The first format is the one the site plays by default
+	extractedInfos := &downloader.VideoInfos{URL: formats[0].URL, Extension: formats[0].Extension, Formats: formats}
 
-	// For + switch because I might want more infos in the future
-	extractedInfos := &downloader.VideoInfos{}
-	for _, info := range []string{"url", "type"} {
-		infoExtracted, infoExist := infosParsed[info]
+	titleSlice, okTitle := query["title"]
+	if !okTitle {
+		return nil, errors.New("Error no 'title' key on query")
+	}
+	if len(titleSlice) < 1 {
+		return nil, errors.New("Error no 'title' value encountered")
+	}
+	extractedInfos.Title = titleSlice[0]
+	if author, okAuthor := query["author"]; okAuthor && len(author) > 0 {
+		extractedInfos.Uploader = author[0]
+	}
+	extractedInfos.Duration, _ = strconv.ParseFloat(query.Get("length_seconds"), 64)
 
-		if !infoExist {
-			return nil, fmt.Errorf("Error no url [%s] encountered for [%s]", info, videoInfoURL)
-		}
-		if len(infoExtracted) < 1 {
-			return nil, fmt.Errorf("Error no info [%s] encountered for [%s]", info, videoInfoURL)
-		}
+	return extractedInfos, nil
+}
+
+// qualityHeights gives the height of the named qualities of a format
+var qualityHeights = map[string]int{
+	"tiny":   144,
+	"small":  240,
+	"medium": 360,
+	"large":  480,
+	"hd720":  720,
+	"hd1080": 1080,
+	"hd1440": 1440,
+	"hd2160": 2160,
+}
 
-		switch info {
-		case "url":
-			extractedInfos.URL = infoExtracted[0]
-		case "type":
-			extractedInfos.Extension, err = getExtensionFromType(infoExtracted[0])
+// parseFormats - Parse the encoded stream infos, each value holds comma separated formats such as
+// `itag=22&url=...&type=video%2Fmp4%3B+codecs%3D%22avc1%22&quality=hd720`. Formats without URL
+// or with an unsupported type are ignored
+func parseFormats(streamInfos []string) ([]downloader.Format, error) {
+	var formats []downloader.Format
+	for _, streamInfo := range streamInfos {
+		for _, encoded := range strings.Split(streamInfo, ",") {
+			if "" == strings.TrimSpace(encoded) {
+				continue
+			}
+			infos, err := url.ParseQuery(encoded)
 			if nil != err {
-				return nil, errors.Wrapf(err, "Error on info [%s] encountered for [%s]", info, videoInfoURL)
+				return nil, errors.Wrapf(err, "Error parsing format [%s]", encoded)
+			}
+			format := downloader.Format{ID: infos.Get("itag"), URL: infos.Get("url")}
+			if "" == format.URL {
+				logrus.Debugf("Ignore format [%s] without url", format.ID)
+				continue
+			}
+			typeValue := infos.Get("type")
+			if format.Extension, err = getExtensionFromType(typeValue); nil != err {
+				logrus.Debugf("Ignore format [%s], reason: %v", format.ID, err)
+				continue
 			}
+			format.MimeType, format.Codecs = splitType(typeValue)
+			format.Width, format.Height = formatResolution(infos)
+			format.Bitrate, _ = strconv.ParseInt(infos.Get("bitrate"), 10, 64)
+			format.Size, _ = strconv.ParseInt(infos.Get("clen"), 10, 64)
+			formats = append(formats, format)
 		}
 	}
-
-	titleSlice, okTitle := query["title"]
-	if !okTitle {
-		return nil, errors.Wrap(err, "Error no 'title' key on query")
+	if 0 == len(formats) {
+		return nil, errors.New("No format holding an [url] and a supported [type] encountered")
 	}
-	if len(titleSlice) < 1 {
-		return nil, errors.Wrap(err, "Error no 'title'  value encountered")
+	return formats, nil
+}
+
+// splitType - Returns the mime-type and the codecs of a `video/mp4; codecs="avc1, mp4a"` type
+func splitType(typeValue string) (string, string) {
+	mimeType, params, err := mime.ParseMediaType(typeValue)
+	if nil != err {
+		return strings.TrimSpace(strings.Split(typeValue, ";")[0]), ""
 	}
-	extractedInfos.Title = titleSlice[0]
+	return mimeType, params["codecs"]
+}
 
-	return extractedInfos, err
+// formatResolution - Returns the width and height of a format, from its `size`, `quality_label`
+// or `quality` informations, 0 when unknown
+func formatResolution(infos url.Values) (int, int) {
+	if size := strings.SplitN(infos.Get("size"), "x", 2); 2 == len(size) {
+		width, errWidth := strconv.Atoi(size[0])
+		height, errHeight := strconv.Atoi(size[1])
+		if nil == errWidth && nil == errHeight {
+			return width, height
+		}
+	}
+	if label := infos.Get("quality_label"); "" != label {
+		digits := strings.IndexFunc(label, func(r rune) bool { return r < '0' || r > '9' })
+		if digits < 0 {
+			digits = len(label)
+		}
+		if height, err := strconv.Atoi(label[:digits]); nil == err {
+			return 0, height
+		}
+	}
+	return 0, qualityHeights[infos.Get("quality")]
 }
 
 // getExtensionFromType Parse the type value returned and try to gets the extension from it
 func getExtensionFromType(typeValue string) (string, error) {
-	parts := strings.Split(typeValue, "; ")
-	extension, err := mime.ExtensionsByType(parts[0])
-	if nil != extension && len(extension) > 0 {
-		// Many extension may be possible, we just use the 1st one
-		return extension[0], err
-	} else {
-		return "", fmt.Errorf("Type information contains no mime-type supported [%s]", typeValue)
-	}
-
-	return "", errors.Wrapf(err, "Error trying to get mime-type from [%s]", typeValue)
+	return downloader.ExtensionFromType(typeValue)
 }
@@ -1,9 +1,14 @@
 package u
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"video-downloader/downloader"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -95,3 +100,88 @@ func TestFindVideoID(t *testing.T) {
 	assert.Equal(t, "", id)
 	assert.EqualError(t, err, "Empty delimiter for `findVideoID`")
 }
+
+func TestMatch(t *testing.T) {
+	UTestInstance := &U{Delimiter: "watch?v="}
+	assert.True(t, UTestInstance.Match("http://anything.test/watch?v=abc"))
+	assert.False(t, UTestInstance.Match("http://anything.test/abc"))
+
+	UTestInstance.Hosts = []string{"u.test"}
+	assert.True(t, UTestInstance.Match("http://www.u.test/watch?v=abc"))
+	assert.False(t, UTestInstance.Match("http://anything.test/watch?v=abc"))
+	assert.False(t, UTestInstance.Match("http://u.test/abc"))
+
+	assert.False(t, (&U{}).Match("http://u.test/watch?v=abc"))
+}
+
+func TestParseFormats(t *testing.T) {
+	streamInfos := []string{
+		"itag=22&url=http%3A%2F%2Fu.test%2F22&type=video%2Fmp4%3B+codecs%3D%22avc1.64001F%2C+mp4a.40.2%22&quality=hd720," +
+			"itag=43&url=http%3A%2F%2Fu.test%2F43&type=video%2Fwebm%3B+codecs%3D%22vp8.0%2C+vorbis%22&quality=medium," +
+			"itag=99&type=video%2Fmp4",
+		"itag=137&url=http%3A%2F%2Fu.test%2F137&type=video%2Fmp4&size=1920x1080&bitrate=4000000&clen=1000," +
+			"itag=140&url=http%3A%2F%2Fu.test%2F140&type=audio%2Fmp4%3B+codecs%3D%22mp4a.40.2%22&bitrate=128000," +
+			"itag=278&url=http%3A%2F%2Fu.test%2F278&type=video%2Fwebm&quality_label=144p30," +
+			"itag=1&url=http%3A%2F%2Fu.test%2F1&type=unknown%2Ftype",
+	}
+	formats, err := parseFormats(streamInfos)
+	assert.Nil(t, err)
+	assert.Equal(t, []downloader.Format{
+		{ID: "22", URL: "http://u.test/22", Extension: ".mp4", MimeType: "video/mp4", Codecs: "avc1.64001F, mp4a.40.2", Height: 720},
+		{ID: "43", URL: "http://u.test/43", Extension: ".webm", MimeType: "video/webm", Codecs: "vp8.0, vorbis", Height: 360},
+		{ID: "137", URL: "http://u.test/137", Extension: ".mp4", MimeType: "video/mp4", Width: 1920, Height: 1080, Bitrate: 4000000, Size: 1000},
+		{ID: "140", URL: "http://u.test/140", Extension: ".m4a", MimeType: "audio/mp4", Codecs: "mp4a.40.2", Bitrate: 128000},
+		{ID: "278", URL: "http://u.test/278", Extension: ".webm", MimeType: "video/webm", Height: 144},
+	}, formats)
+
+	formats, err = parseFormats([]string{"itag=99&type=video%2Fmp4"})
+	assert.Nil(t, formats)
+	assert.EqualError(t, err, "No format holding an [url] and a supported [type] encountered")
+}
+
+func TestParse(t *testing.T) {
+	stream := "itag=22&url=" + url.QueryEscape("http://u.test/22") + "&type=" + url.QueryEscape("video/mp4")
+	responses := map[string]url.Values{
+		"abc": {"streams": {stream}, "title": {"A video"}, "author": {"someone"}},
+		"nti": {"streams": {stream}},
+		"nky": {"title": {"A video"}},
+		"emp": {"streams": {""}, "title": {"A video"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Query().Get("id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, response.Encode())
+	}))
+	defer server.Close()
+
+	UTestInstance := &U{Delimiter: "watch?v=", UidSize: 3, QueryKeywordURL: "streams", UrlsInfos: []string{server.URL + "/infos?id="}}
+	videoInfos, err := UTestInstance.Parse(context.Background(), "http://u.test/watch?v=abc")
+	assert.Nil(t, err)
+	if assert.NotNil(t, videoInfos) {
+		assert.Equal(t, "abc", videoInfos.ID)
+		assert.Equal(t, "A video", videoInfos.Title)
+		assert.Equal(t, "someone", videoInfos.Uploader)
+		assert.Equal(t, "http://u.test/22", videoInfos.URL)
+	}
+
+	// Wrong cases - incomplete responses are errors, never empty informations
+	cases := map[string]string{
+		"nti": "Error no 'title' key on query",
+		"nky": "Error no 'streams' key on query",
+		"emp": "Error no 'streams' infos on key found from video information",
+	}
+	for id, expected := range cases {
+		pageURL := "http://u.test/watch?v=" + id
+		videoInfos, err = UTestInstance.Parse(context.Background(), pageURL)
+		assert.Nil(t, videoInfos, id)
+		assert.EqualError(t, err, "Run `parseVideoInfo` error on url ["+pageURL+"]: "+expected, id)
+	}
+
+	UTestInstance.UrlsInfos = nil
+	videoInfos, err = UTestInstance.Parse(context.Background(), "http://u.test/watch?v=abc")
+	assert.Nil(t, videoInfos)
+	assert.EqualError(t, err, "Run `parseVideoInfo` error on url [http://u.test/watch?v=abc]: Error no 'streams' infos on key found from video information")
+}
@@ -0,0 +1,223 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Default values used for the fields of a Policy left empty in the configuration
+const (
+	DefaultAttempts       = 3
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultMultiplier     = 2
+	DefaultJitter         = 0.2
+)
+
+// DefaultRetryableStatus are the HTTP status worth asking again when none are configured
+var DefaultRetryableStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Policy tells how a request failing because of the network or the server is tried again.
+// Empty fields take the default values; a nil Policy never retries.
+// The structure can be accessed concurrently by many goroutines
+type Policy struct {
+	// Attempts is the total number of tries, 1 disables retries
+	Attempts int `mapstructure:"attempts"`
+	// InitialBackoff is the delay before the first retry, it grows by Multiplier after each retry
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	// MaxBackoff bounds the delay between two tries, `Retry-After` included
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	Multiplier float64       `mapstructure:"multiplier"`
+	// Jitter is the fraction, in ]0, 1], of the delay randomly removed so clients don't retry all together
+	Jitter float64 `mapstructure:"jitter"`
+	// RetryableStatus are the HTTP status codes considered transient
+	RetryableStatus []int `mapstructure:"retryable_status"`
+}
+
+// StatusError is returned when a server answered with a status code out of the 2xx class
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay asked by the server through `Retry-After`, 0 when none
+	RetryAfter time.Duration
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("Server answered [%s] for [%s]", se.Status, se.URL)
+}
+
+// CheckStatus - Returns a *StatusError when the response status is not a 2xx. Policies decide
+// with their RetryableStatus whether such an error is worth another attempt.
+// The body of resp is left open, it's up to the caller to close it
+func CheckStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	return &StatusError{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (p *Policy) attempts() int {
+	if nil == p {
+		return 1
+	}
+	if p.Attempts <= 0 {
+		return DefaultAttempts
+	}
+	return p.Attempts
+}
+
+func (p *Policy) retryableStatus() []int {
+	if 0 == len(p.RetryableStatus) {
+		return DefaultRetryableStatus
+	}
+	return p.RetryableStatus
+}
+
+// isRetryableStatus - Check the policy retries the status code
+func (p *Policy) isRetryableStatus(statusCode int) bool {
+	if nil == p {
+		return false
+	}
+	for _, retryable := range p.retryableStatus() {
+		if retryable == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Do - Call attempt until it succeeds, fails for a reason that is not transient or the attempts
+// are exhausted. description tells in logs and errors what was tried
+func (p *Policy) Do(description string, attempt func() error) error {
+	return p.DoContext(context.Background(), description, attempt)
+}
+
+// DoContext - Same as Do, but no attempt is made anymore once ctx is done, the wait between two
+// attempts included
+func (p *Policy) DoContext(ctx context.Context, description string, attempt func() error) error {
+	attempts := p.attempts()
+	var err error
+	for i := 1; ; i++ {
+		if err = attempt(); nil == err {
+			return nil
+		}
+		if 1 == attempts || nil != ctx.Err() || !p.retryable(err) {
+			return err
+		}
+		if i >= attempts {
+			break
+		}
+
+		delay := p.delay(i, err)
+		logrus.Warnf("Attempt [%d/%d] %s failed, retry in %v, reason: %v", i, attempts, description, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(ctx.Err(), "Stopped %s, last failure: %v", description, err)
+		}
+	}
+	return errors.Wrapf(err, "Giving up %s after [%d] attempts", description, attempts)
+}
+
+// retryable - Check err is worth another attempt
+func (p *Policy) retryable(err error) bool {
+	cause := errors.Cause(err)
+	if statusErr, ok := cause.(*StatusError); ok {
+		return p.isRetryableStatus(statusErr.StatusCode)
+	}
+	return IsTransient(cause)
+}
+
+// delay - Returns how long to wait after the given failed attempt, starting at 1
+func (p *Policy) delay(attempt int, err error) time.Duration {
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = DefaultMultiplier
+	}
+	jitter := p.Jitter
+	if jitter <= 0 || jitter > 1 {
+		jitter = DefaultJitter
+	}
+
+	delay := float64(backoff)
+	for i := 1; i < attempt && delay < float64(maxBackoff); i++ {
+		delay *= multiplier
+	}
+	delay -= delay * jitter * rand.Float64()
+
+	// The server knows better when it will be available again
+	if statusErr, ok := errors.Cause(err).(*StatusError); ok && float64(statusErr.RetryAfter) > delay {
+		delay = float64(statusErr.RetryAfter)
+	}
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+// IsTransient - Check err comes from the network and may not happen again: timeouts, connections
+// reset or refused, bodies cut before their end...
+func IsTransient(err error) bool {
+	err = errors.Cause(err)
+	// url.Error implements net.Error whatever it wraps, look inside
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if io.ErrUnexpectedEOF == err || io.EOF == err {
+		return true
+	}
+	_, isNetError := err.(net.Error)
+	return isNetError
+}
+
+// parseRetryAfter - Parse a `Retry-After` header value, either a number of seconds or a date
+func parseRetryAfter(value string) time.Duration {
+	if "" == value {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); nil == err {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); nil == err {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	policy := &Policy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	transient := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+	// Right case - succeeds on the last attempt
+	calls := 0
+	err := policy.Do("testing", func() error {
+		calls++
+		if calls < 3 {
+			return pkgerrors.Wrap(transient, "Error fetching")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Wrong case - attempts exhausted
+	calls = 0
+	err = policy.Do("testing", func() error {
+		calls++
+		return transient
+	})
+	assert.Equal(t, 3, calls)
+	assert.EqualError(t, err, "Giving up testing after [3] attempts: read: connection reset by peer")
+
+	// Wrong case - not transient, no retry
+	calls = 0
+	err = policy.Do("testing", func() error {
+		calls++
+		return errors.New("disk full")
+	})
+	assert.Equal(t, 1, calls)
+	assert.EqualError(t, err, "disk full")
+
+	// A nil policy never retries
+	calls = 0
+	var nilPolicy *Policy
+	err = nilPolicy.Do("testing", func() error {
+		calls++
+		return transient
+	})
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, transient, err)
+}
+
+func TestDoContext(t *testing.T) {
+	policy := &Policy{Attempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	transient := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+	// The wait before the next attempt is interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := policy.DoContext(ctx, "testing", func() error {
+		calls++
+		time.AfterFunc(time.Millisecond, cancel)
+		return transient
+	})
+	assert.Equal(t, 1, calls)
+	assert.EqualError(t, err, "Stopped testing, last failure: read: connection reset by peer: context canceled")
+
+	// No other attempt once done
+	calls = 0
+	err = policy.DoContext(ctx, "testing", func() error {
+		calls++
+		return transient
+	})
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, transient, err)
+}
+
+func TestCheckStatus(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	policy := &Policy{}
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	err = CheckStatus(resp)
+	assert.Equal(t, &StatusError{URL: server.URL, StatusCode: 503, Status: "503 Service Unavailable", RetryAfter: 2 * time.Second}, err)
+	assert.True(t, policy.retryable(err))
+
+	// Not in the configured status
+	policy.RetryableStatus = []int{http.StatusTooManyRequests}
+	assert.False(t, policy.retryable(err))
+
+	// Errors that are never retried by default
+	status = http.StatusNotFound
+	resp, err = http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	err = CheckStatus(resp)
+	assert.EqualError(t, err, "Server answered [404 Not Found] for ["+server.URL+"]")
+	assert.False(t, (&Policy{}).retryable(err))
+
+	status = http.StatusPartialContent
+	resp, err = http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Nil(t, CheckStatus(resp))
+}
+
+func TestDelay(t *testing.T) {
+	policy := &Policy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+	for attempt, maxDelay := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		delay := policy.delay(attempt, errors.New("failure"))
+		assert.True(t, delay <= maxDelay, "attempt %d: %v", attempt, delay)
+		assert.True(t, delay >= maxDelay/2, "attempt %d: %v", attempt, delay)
+	}
+
+	// Retry-After is honoured, up to MaxBackoff
+	assert.Equal(t, 5*time.Second, policy.delay(1, &StatusError{RetryAfter: 5 * time.Second}))
+	assert.Equal(t, 10*time.Second, policy.delay(1, &StatusError{RetryAfter: time.Hour}))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(io.ErrUnexpectedEOF))
+	assert.True(t, IsTransient(pkgerrors.Wrap(&url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, "Error fetching")))
+	assert.False(t, IsTransient(&url.Error{Op: "Get", URL: "x://x", Err: errors.New("unsupported protocol scheme")}))
+	assert.False(t, IsTransient(errors.New("disk full")))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	delay := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, delay > 50*time.Second && delay <= time.Minute)
+}